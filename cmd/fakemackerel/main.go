@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/tukaelu/ikesu/internal/fakemackerel"
+)
+
+// fakemackerel serves a fake Mackerel API loaded from a fixture, so that ikesu can be run locally with --apibase.
+func main() {
+	app := &cli.App{
+		Name:      "fakemackerel",
+		Usage:     "Serve a fake Mackerel API for running ikesu locally.",
+		UsageText: "fakemackerel --fixture <fixture file> [--addr 127.0.0.1:8080]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "fixture",
+				Usage:    "Specify the path to the fixture file that defines the services, hosts and metrics.",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "addr",
+				Usage: "Specify the address to listen on.",
+				Value: "127.0.0.1:8080",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			fixture, err := fakemackerel.LoadFixture(ctx.String("fixture"))
+			if err != nil {
+				return err
+			}
+			server := fakemackerel.NewServer()
+			if err := server.Load(fixture, time.Now()); err != nil {
+				return err
+			}
+
+			hs := &http.Server{Addr: ctx.String("addr"), Handler: server}
+			go func() {
+				<-ctx.Context.Done()
+				_ = hs.Shutdown(context.Background())
+			}()
+			log.Printf("Listening on http://%s/ (the posted reports are shown at /_fake/reports)", ctx.String("addr"))
+			if err := hs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
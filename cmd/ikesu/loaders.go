@@ -2,6 +2,13 @@ package main
 
 // Register as loader.
 import (
+	_ "github.com/tukaelu/ikesu/internal/config/loader/azblob"
+	_ "github.com/tukaelu/ikesu/internal/config/loader/env"
 	_ "github.com/tukaelu/ikesu/internal/config/loader/file"
+	_ "github.com/tukaelu/ikesu/internal/config/loader/gs"
+	_ "github.com/tukaelu/ikesu/internal/config/loader/http"
 	_ "github.com/tukaelu/ikesu/internal/config/loader/s3"
+	_ "github.com/tukaelu/ikesu/internal/config/loader/secretsmanager"
+	_ "github.com/tukaelu/ikesu/internal/config/loader/ssm"
+	_ "github.com/tukaelu/ikesu/internal/config/loader/stdin"
 )
@@ -22,9 +22,9 @@ func main() {
 		Usage: "Manage the health condition of the fish in the \"Ikesu\".",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "apikey",
-				EnvVars:  []string{"MACKEREL_APIKEY", "IKESU_MACKEREL_APIKEY"},
-				Required: true,
+				Name:    "apikey",
+				Usage:   "Specify the API key of Mackerel. It is required by the commands accessing Mackerel.",
+				EnvVars: []string{"MACKEREL_APIKEY", "IKESU_MACKEREL_APIKEY"},
 			},
 			&cli.StringFlag{
 				Name:    "apibase",
@@ -50,6 +50,8 @@ func main() {
 		},
 		Commands: []*cli.Command{
 			subcommand.NewCheckCommand(),
+			subcommand.NewServeCommand(),
+			subcommand.NewConfigCommand(),
 		},
 	}
 
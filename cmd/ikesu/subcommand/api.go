@@ -0,0 +1,94 @@
+package subcommand
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+)
+
+// MackerelClient is the subset of the Mackerel API client used by ikesu.
+type MackerelClient interface {
+	FindServices() ([]*mackerel.Service, error)
+	FindRoles(serviceName string) ([]*mackerel.Role, error)
+	FindHosts(param *mackerel.FindHostsParam) ([]*mackerel.Host, error)
+	ListHostMetricNames(hostID string) ([]string, error)
+	ListServiceMetricNames(serviceName string) ([]string, error)
+	FetchHostMetricValues(hostID string, metricName string, from int64, to int64) ([]mackerel.MetricValue, error)
+	FetchServiceMetricValues(serviceName string, metricName string, from int64, to int64) ([]mackerel.MetricValue, error)
+	FetchLatestMetricValues(hostIDs []string, metricNames []string) (mackerel.LatestMetricValues, error)
+	PostCheckReports(checkReports *mackerel.CheckReports) error
+}
+
+var _ MackerelClient = (*mackerel.Client)(nil)
+
+const (
+	maxRateLimitedRetries = 5
+	maxRateLimitedBackoff = 30 * time.Second
+)
+
+// rateLimitedBackoff is the initial wait time after a 429 response, and it doubles with each retry.
+var rateLimitedBackoff = 1 * time.Second
+
+// callAPI calls the Mackerel API after acquiring a token from the limiter shared by all rules.
+// If the API responds with 429 Too Many Requests, it backs off exponentially and retries.
+func (c *Check) callAPI(ctx context.Context, fn func() error) error {
+	backoff := rateLimitedBackoff
+	for attempt := 0; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		err := fn()
+		if !isTooManyRequests(err) || attempt >= maxRateLimitedRetries {
+			return err
+		}
+		c.Log.Warn("The Mackerel API responded with too many requests, so it will back off and retry.", "attempt", attempt+1, "backoff", backoff.String())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRateLimitedBackoff)
+	}
+}
+
+// isMetricNotFound returns whether the error is 'metric not found', which is returned for the metric without any value posted
+// and is a part of the normal operation rather than a failure.
+func isMetricNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "metric not found")
+}
+
+func isTooManyRequests(err error) bool {
+	var apiErr *mackerel.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// parallelMap applies fn to each item with at most n goroutines at the same time.
+// The results are returned in the same order as the items regardless of the order of completion.
+func parallelMap[T, R any](n int, items []T, fn func(T) R) []R {
+	if n < 1 {
+		n = 1
+	}
+	results := make([]R, len(items))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = fn(items[i])
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,96 @@
+package subcommand
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+func TestCallAPIRetriesTooManyRequests(t *testing.T) {
+	defer func(d time.Duration) { rateLimitedBackoff = d }(rateLimitedBackoff)
+	rateLimitedBackoff = time.Millisecond
+
+	l, _ := logger.NewLogger("", "error", false)
+	c := &Check{Limiter: newLimiter(1000), Logger: l}
+
+	t.Run("retries until it succeeds", func(t *testing.T) {
+		calls := 0
+		err := c.callAPI(context.TODO(), func() error {
+			calls++
+			if calls < 3 {
+				return &mackerel.APIError{StatusCode: http.StatusTooManyRequests}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after the maximum number of retries", func(t *testing.T) {
+		calls := 0
+		err := c.callAPI(context.TODO(), func() error {
+			calls++
+			return &mackerel.APIError{StatusCode: http.StatusTooManyRequests}
+		})
+		assert.True(t, isTooManyRequests(err))
+		assert.Equal(t, maxRateLimitedRetries+1, calls)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		err := c.callAPI(context.TODO(), func() error {
+			calls++
+			return &mackerel.APIError{StatusCode: http.StatusInternalServerError}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestCallAPIWithCanceledContext(t *testing.T) {
+	l, _ := logger.NewLogger("", "error", false)
+	c := &Check{Limiter: newLimiter(1), Logger: l}
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	called := false
+	err := c.callAPI(ctx, func() error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, called)
+}
+
+func TestParallelMap(t *testing.T) {
+	var running, peak atomic.Int32
+	items := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	results := parallelMap(3, items, func(i int) int {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// The later items finish earlier, but the order of the results must be kept.
+		time.Sleep(time.Duration(len(items)-i) * time.Millisecond)
+		running.Add(-1)
+		return i * 10
+	})
+	assert.Equal(t, []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, results)
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+}
+
+func TestNewLimiter(t *testing.T) {
+	assert.Nil(t, newLimiter(0))
+	assert.NotNil(t, newLimiter(0.5))
+	assert.Equal(t, 10, newLimiter(10).Burst())
+}
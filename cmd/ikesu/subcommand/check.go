@@ -2,7 +2,10 @@ package subcommand
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"slices"
 	"strings"
@@ -11,10 +14,12 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/mackerelio/mackerel-client-go"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/time/rate"
 
 	"github.com/tukaelu/ikesu/internal/config"
 	"github.com/tukaelu/ikesu/internal/constants"
 	"github.com/tukaelu/ikesu/internal/logger"
+	"github.com/tukaelu/ikesu/internal/metricname"
 )
 
 // NewCheckCommand returns a command that detects disruptions in posted metrics and notifies the host as a CRITICAL alert.
@@ -22,7 +27,7 @@ func NewCheckCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "check",
 		Usage:     "Detects disruptions in posted metrics and notifies the host as a CRITICAL alert.",
-		UsageText: "ikesu check -config <config file> [-dry-run]",
+		UsageText: "ikesu check -config <config file> [-config <config file>...] [-dry-run [-output json|table|csv]]",
 		Action: func(ctx *cli.Context) error {
 
 			// Show the provider name and metric name, then terminate.
@@ -31,40 +36,18 @@ func NewCheckCommand() *cli.Command {
 				return nil
 			}
 
-			var l *logger.Logger
-			var err error
-			if l, err = logger.NewLogger(ctx.String("log"), ctx.String("log-level"), ctx.Bool("dry-run")); err != nil {
-				return err
-			}
-
-			config, err := config.NewCheckConfig(ctx.Context, ctx.String("config"))
+			check, err := newCheck(ctx)
 			if err != nil {
 				return err
 			}
-			if err := config.Validate(); err != nil {
-				return err
-			}
-			client, err := mackerel.NewClientWithOptions(
-				ctx.String("apikey"),
-				ctx.String("apibase"),
-				false,
-			)
-			if err != nil {
-				return err
-			}
-			check := &Check{
-				Config: config,
-				Client: client,
-				DryRun: ctx.Bool("dry-run"),
-				Logger: l,
-			}
+			l := check.Logger
 
 			// wrap function
 			handler := func(ctx context.Context) error {
 				return check.Run(ctx)
 			}
 			l.Log.Info("Run command", "version", ctx.App.Version)
-			l.Log.Debug("Config", "dump", fmt.Sprintf("%+v", config))
+			check.logConfig()
 
 			if isLambda() {
 				lambda.StartWithOptions(handler, lambda.WithContext(ctx.Context))
@@ -72,121 +55,168 @@ func NewCheckCommand() *cli.Command {
 			}
 			return handler(ctx.Context)
 		},
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:    "config",
-				Usage:   "Specify the path to the configuration file.",
-				Aliases: []string{"c"},
-				EnvVars: []string{"IKESU_CHECK_CONFIG"},
-			},
+		Flags: append([]cli.Flag{
 			&cli.BoolFlag{
 				Name:  "show-providers",
 				Usage: "List the inspection metric names corresponding to the provider for each integration.",
 			},
-			&cli.BoolFlag{
-				Name:  "dry-run",
-				Usage: "Only a simplified display of the check results is performed, and no alerts are issued.",
-			},
+		}, checkFlags()...),
+	}
+}
+
+// checkFlags returns the flags shared by the commands that inspect the metrics according to the rules.
+func checkFlags() []cli.Flag {
+	return append([]cli.Flag{
+		configFlag(),
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only a simplified display of the check results is performed, and no alerts are issued.",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "Specify the output format of the check results in dry-run mode. (json, table or csv)",
+			Aliases: []string{"o"},
+			Value:   outputTable,
 		},
+	}, apiFlags()...)
+}
+
+// configFlag returns the flag to specify the configuration.
+func configFlag() *cli.StringSliceFlag {
+	return &cli.StringSliceFlag{
+		Name:    "config",
+		Usage:   "Specify the path to the configuration file, a directory or a glob pattern. It can be specified more than once to merge the rules.",
+		Aliases: []string{"c"},
+		EnvVars: []string{"IKESU_CHECK_CONFIG"},
 	}
 }
 
+// apiFlags returns the flags to control the calls of the Mackerel API.
+func apiFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    "concurrency",
+			Usage:   "Specify the number of hosts to be inspected concurrently.",
+			EnvVars: []string{"IKESU_CONCURRENCY"},
+			Value:   4,
+		},
+		&cli.Float64Flag{
+			Name:    "api-rate-limit",
+			Usage:   "Specify the maximum number of Mackerel API requests per second. If 0 is specified, it is unlimited.",
+			EnvVars: []string{"IKESU_API_RATE_LIMIT"},
+			Value:   10,
+		},
+	}
+}
+
+var errNoAPIKey = errors.New("The API key is not specified. Please specify it with --apikey or MACKEREL_APIKEY.")
+
+// newCheck returns a Check built from the flags, loading and validating the configuration.
+func newCheck(ctx *cli.Context) (*Check, error) {
+	if !slices.Contains(outputFormats, ctx.String("output")) {
+		return nil, fmt.Errorf("unsupported output format, %s has been set", ctx.String("output"))
+	}
+
+	l, err := logger.NewLogger(ctx.String("log"), ctx.String("log-level"), ctx.Bool("dry-run"))
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := config.NewCheckConfig(ctx.Context, ctx.StringSlice("config")...)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Check{
+		Config:      config,
+		Client:      client,
+		DryRun:      ctx.Bool("dry-run"),
+		Output:      ctx.String("output"),
+		Limiter:     newLimiter(ctx.Float64("api-rate-limit")),
+		Concurrency: ctx.Int("concurrency"),
+		Logger:      l,
+	}, nil
+}
+
+// newClient returns the client of the Mackerel API with the global flags.
+func newClient(ctx *cli.Context) (*mackerel.Client, error) {
+	if ctx.String("apikey") == "" {
+		return nil, errNoAPIKey
+	}
+	return mackerel.NewClientWithOptions(
+		ctx.String("apikey"),
+		ctx.String("apibase"),
+		false,
+	)
+}
+
 type Check struct {
 	Config *config.CheckConfig
-	Client *mackerel.Client
+	Client MackerelClient
 	DryRun bool
+	// Output is the format of the results displayed in dry-run mode, one of outputFormats.
+	Output string
+	// Out is where the results are displayed in dry-run mode. If nil, os.Stdout is used.
+	Out io.Writer
+
+	// Limiter is shared by all API calls across the rules. If nil, the calls are not throttled.
+	Limiter *rate.Limiter
+	// Concurrency is the number of hosts to be inspected at the same time.
+	Concurrency int
 
 	*logger.Logger
 }
 
-// FIXME: If 'service' is ever added to CheckSource.Type, it may be necessary to consider separating the logic.
-// see. https://github.com/mackerelio/mackerel-client-go/blob/264b7b7a402a9638b8137ec0a8ab9b8e950eef5a/checks.go#L16
+// logConfig logs the effective rules, in which the defaults are applied. They are logged at the info level in dry-run mode, otherwise at the debug level.
+func (c *Check) logConfig() {
+	level := slog.LevelDebug
+	if c.DryRun {
+		level = slog.LevelInfo
+	}
+	c.Log.Log(context.Background(), level, "Config", "dump", c.Config.Dump())
+}
+
+// Run inspects the metrics of the hosts and services according to all the rules of the configuration and reports the results.
 func (c *Check) Run(ctx context.Context) error {
-	var reports []*mackerel.CheckReport
+	_, err := c.runRules(ctx, c.Config.Rules, c.Config.ServiceRules)
+	return err
+}
 
-	checkedAt := time.Now().Unix()
-	for _, rule := range c.Config.Rules {
-		c.Log.Info("CheckRule", "name", rule.Name)
-		p := &mackerel.FindHostsParam{
-			Service: rule.Service,
-		}
-		if rule.Roles != nil {
-			p.Roles = append(p.Roles, rule.Roles...)
-		}
+// runRules inspects the metrics according to the rules, reports the results and returns them.
+// Host rules and service rules are evaluated separately, see checkServiceRules for the latter.
+func (c *Check) runRules(ctx context.Context, rules []config.MetricCheckRule, serviceRules []config.ServiceMetricCheckRule) ([]*checkResult, error) {
+	var results []*checkResult
 
-		hosts, err := c.Client.FindHosts(p)
+	checkedAt := time.Now().Unix()
+	for _, rule := range rules {
+		ruleResults, err := c.checkHostRule(ctx, rule, checkedAt)
 		if err != nil {
-			c.Log.Error("Failed to retrieve the hosts.", "reason", err.Error())
-			return err
+			return nil, err
 		}
-		c.Log.Info("Retrieved target hosts.", "service", rule.Service, "roles", rule.Roles, "count", len(hosts))
-
-		for _, host := range hosts {
-			provider := getHostProviderType(host)
-			c.Log.Info("Determine the provider of the host.", "host", host.ID, "provider", provider)
-
-			// If the provider is explicitly stated in YAML, validation will only be performed on matching hosts.
-			if len(rule.Providers) > 0 {
-				if !slices.Contains[[]config.Provider, config.Provider](rule.Providers, config.Provider(provider)) {
-					c.Log.Info("Skipping because it is not the target provider.", "host", host.ID, "provider", provider)
-					continue
-				}
-			}
-
-			metricNames := make([]string, 0)
-			if suggested, ok := constants.GetProviderInspectionMetricName(provider); ok {
-				metricNames = append(metricNames, suggested)
-			}
-			if specified, ok := rule.InspectionMetrics[provider]; ok {
-				metricNames = append(metricNames, specified...)
-			}
-
-			if len(metricNames) == 0 {
-				c.Log.Info("Skipping as there are no metrics to inspect.", "host", host.ID, "provider", provider)
-				continue
-			}
-
-			status := mackerel.CheckStatusOK
-			sum := 0
-			message := ""
-			for _, metricName := range metricNames {
-				cnt := 0
-				if cnt, err = c.retrieveMetricsCount(&ctx, host.ID, metricName, rule.InterruptedInterval.ToValue()); err != nil {
-					c.Log.Error(fmt.Sprintf("Due to a failure in retrieving the metric '%s' for host '%s', it will be counted as 0 and the process will continue. ", metricName, host.ID), "reason", err.Error())
-				}
-				sum += cnt
-			}
-			if sum == 0 {
-				status = mackerel.CheckStatusCritical
-				message = fmt.Sprintf(
-					"Metrics have been detected as disrupted for over %s on host '%s' with the provider '%s'. The inspected metric(s) is/are [%s]."+
-						"To verify the exact situation, please check the posting status of the host's metrics.",
-					rule.InterruptedInterval,
-					host.ID,
-					provider,
-					strings.Join(metricNames, ", "),
-				)
-			} else {
-				message = "No disruptions were detected in the metrics."
-			}
+		results = append(results, ruleResults...)
+	}
+	results = append(results, c.checkServiceRules(ctx, serviceRules, checkedAt)...)
 
-			report := &mackerel.CheckReport{
-				Source:     mackerel.NewCheckSourceHost(host.ID),
-				Name:       fmt.Sprint("Ikesu Check(rule=", rule.Name, ")"),
-				Status:     status,
-				Message:    message,
-				OccurredAt: checkedAt,
-			}
-			reports = append(reports, report)
+	if c.DryRun {
+		c.Log.Info("The results will be displayed without reporting, because DryRun mode is specified.")
+		out := c.Out
+		if out == nil {
+			out = os.Stdout
 		}
+		return results, writeResults(out, c.Output, results)
 	}
 
-	if c.DryRun {
-		fmt.Println("--- The report will be displayed and then the process will end, because DryRun mode is specified.")
-		for _, report := range reports {
-			fmt.Printf("%+v\n", report)
+	var reports []*mackerel.CheckReport
+	for _, result := range results {
+		if result.Report != nil {
+			reports = append(reports, result.Report)
 		}
-		return nil
 	}
 
 	// The Post Monitoring Check Reports API requires requests in batches of 100, so it is processed in segments.
@@ -202,13 +232,383 @@ func (c *Check) Run(ctx context.Context) error {
 		if reportCount < end {
 			end = reportCount
 		}
-		if err := c.Client.PostCheckReports(&mackerel.CheckReports{Reports: reports[i:end]}); err != nil {
+		err := c.callAPI(ctx, func() error {
+			return c.Client.PostCheckReports(&mackerel.CheckReports{Reports: reports[i:end]})
+		})
+		if err != nil {
 			c.Log.Error("Failed to post the check monitoring reports.", "progress", fmt.Sprintf("%d/%d", end, reportCount), "reason", err.Error())
-			return err
+			return results, err
 		}
 		c.Log.Debug("Posted the check monitoring reports.", "progress", fmt.Sprintf("%d/%d", end, reportCount))
 	}
-	return nil
+	return results, nil
+}
+
+// checkResult is the result of inspecting a host, or a service in which case Provider is "service".
+// Report is nil if the host was skipped or the report was suppressed by on_api_error.
+type checkResult struct {
+	Rule     string
+	HostID   string
+	HostName string
+	Provider string
+	// Metrics is the metric names inspected, in which the patterns are expanded.
+	Metrics []string
+	// Points is the number of the data points found within the interval inspected last.
+	Points int
+	// LastSeen is the time of the newest data point found for each of Metrics. A metric is absent if none was found.
+	LastSeen map[string]int64
+	Status   mackerel.CheckStatus
+	Skipped  bool
+	Report   *mackerel.CheckReport
+}
+
+// observe records the data points found for the metric name.
+func (r *checkResult) observe(name string, points int, lastSeen int64) {
+	r.Points += points
+	if lastSeen > r.LastSeen[name] {
+		if r.LastSeen == nil {
+			r.LastSeen = make(map[string]int64)
+		}
+		r.LastSeen[name] = lastSeen
+	}
+}
+
+// newestSeen returns the time of the newest data point found for any of the metrics, or 0 if none was found.
+func (r *checkResult) newestSeen() int64 {
+	newest := int64(0)
+	for _, seen := range r.LastSeen {
+		newest = max(newest, seen)
+	}
+	return newest
+}
+
+// checkHostRule inspects the hosts matching the rule concurrently and returns the results in the order of the hosts.
+func (c *Check) checkHostRule(ctx context.Context, rule config.MetricCheckRule, checkedAt int64) ([]*checkResult, error) {
+	c.Log.Info("CheckRule", "name", rule.Name)
+	p := &mackerel.FindHostsParam{
+		Service: rule.Service,
+	}
+	if rule.Roles != nil {
+		p.Roles = append(p.Roles, rule.Roles...)
+	}
+
+	var hosts []*mackerel.Host
+	err := c.callAPI(ctx, func() (err error) {
+		hosts, err = c.Client.FindHosts(p)
+		return err
+	})
+	if err != nil {
+		c.Log.Error("Failed to retrieve the hosts.", "reason", err.Error())
+		return nil, err
+	}
+	c.Log.Info("Retrieved target hosts.", "service", rule.Service, "roles", rule.Roles, "count", len(hosts))
+
+	targets := parallelMap(c.Concurrency, hosts, func(host *mackerel.Host) *hostTarget {
+		return c.newHostTarget(ctx, rule, host)
+	})
+	var latest mackerel.LatestMetricValues
+	if rule.Strategy == config.StrategyLatest {
+		latest = c.fetchLatestMetricValues(ctx, targets)
+	}
+
+	results := parallelMap(c.Concurrency, targets, func(target *hostTarget) *checkResult {
+		return c.inspectHost(ctx, rule, target, latest, checkedAt)
+	})
+
+	summary := &ruleSummary{Rule: rule.Name}
+	for _, result := range results {
+		if result.Skipped {
+			summary.Skipped = append(summary.Skipped, result.HostID)
+			continue
+		}
+		summary.add(result.HostID, result.Status)
+	}
+	c.logSummary(summary)
+	return results, nil
+}
+
+// hostTarget is a host to be inspected with the metric names determined from its provider.
+// If there is nothing to inspect, Skipped is true.
+type hostTarget struct {
+	Host        *mackerel.Host
+	Provider    string
+	MetricNames []string
+	// Expanded is the metric names to be inspected for each of MetricNames, in which the patterns are expanded.
+	Expanded map[string][]string
+	// Err is the failure of retrieving the metric names of the host to expand the patterns.
+	Err     error
+	Skipped bool
+}
+
+// inspectedNames returns the metric names to be actually inspected.
+func (t *hostTarget) inspectedNames() []string {
+	return flattenMetricNames(t.MetricNames, t.Expanded)
+}
+
+func (c *Check) newHostTarget(ctx context.Context, rule config.MetricCheckRule, host *mackerel.Host) *hostTarget {
+	provider := getHostProviderType(host)
+	c.Log.Info("Determine the provider of the host.", "host", host.ID, "provider", provider)
+	target := &hostTarget{Host: host, Provider: provider}
+
+	// If the provider is explicitly stated in YAML, validation will only be performed on matching hosts.
+	if len(rule.Providers) > 0 {
+		if !slices.Contains[[]config.Provider, config.Provider](rule.Providers, config.Provider(provider)) {
+			c.Log.Info("Skipping because it is not the target provider.", "host", host.ID, "provider", provider)
+			target.Skipped = true
+			return target
+		}
+	}
+
+	metricNames := make([]string, 0)
+	if suggested, ok := constants.GetProviderInspectionMetricName(provider); ok {
+		metricNames = append(metricNames, suggested)
+	}
+	if specified, ok := rule.InspectionMetrics[provider]; ok {
+		metricNames = append(metricNames, specified...)
+	}
+
+	if len(metricNames) == 0 {
+		c.Log.Info("Skipping as there are no metrics to inspect.", "host", host.ID, "provider", provider)
+		target.Skipped = true
+		return target
+	}
+	target.MetricNames = metricNames
+	target.Expanded, target.Err = c.expandMetricNames(ctx, metricNames, func() ([]string, error) {
+		return c.Client.ListHostMetricNames(host.ID)
+	})
+	if target.Err != nil {
+		c.Log.Error("Failed to retrieve the metric names to expand the patterns.", "host", host.ID, "reason", target.Err.Error())
+	}
+	c.Log.Debug("Determine the metric names to be inspected.", "host", host.ID, "metrics", target.inspectedNames())
+	return target
+}
+
+func (c *Check) inspectHost(ctx context.Context, rule config.MetricCheckRule, target *hostTarget, latest mackerel.LatestMetricValues, checkedAt int64) *checkResult {
+	host, provider, metricNames := target.Host, target.Provider, target.MetricNames
+	result := &checkResult{
+		Rule:     rule.Name,
+		HostID:   host.ID,
+		HostName: hostName(host),
+		Provider: provider,
+		Metrics:  target.inspectedNames(),
+		Skipped:  target.Skipped,
+	}
+	if target.Skipped {
+		return result
+	}
+
+	presenceWithin := func(interval int32) ([]metricPresence, error) {
+		result.Points = 0
+		return presenceOf(metricNames, target.Expanded, target.Err, func(name string) (int, error) {
+			cnt, lastSeen, err := c.countHostMetricValues(ctx, host.ID, name, interval, latest)
+			if err != nil {
+				c.Log.Error(fmt.Sprintf("Failed to retrieve the metric '%s' for host '%s'.", name, host.ID), "reason", err.Error())
+			}
+			result.observe(name, cnt, lastSeen)
+			return cnt, err
+		})
+	}
+	warning, critical := rule.Thresholds()
+	status, threshold, missing, err := judgeStatus(warning, critical, rule.RequiredMetrics(len(metricNames)), presenceWithin)
+	result.Status = status
+
+	message := ""
+	switch status {
+	case mackerel.CheckStatusOK:
+		message = "No disruptions were detected in the metrics."
+	case mackerel.CheckStatusUnknown:
+		if rule.OnAPIError.Skip() {
+			c.Log.Warn("Skipping the report because the posting status could not be determined.", "host", host.ID, "reason", err.Error())
+			return result
+		}
+		message = fmt.Sprintf(
+			"The posting status of the metrics on host '%s' with the provider '%s' could not be determined due to a failure of the Mackerel API. The inspected metric(s) is/are [%s]. reason: %s",
+			host.ID,
+			provider,
+			strings.Join(metricNames, ", "),
+			err.Error(),
+		)
+	default:
+		missingNames := pickMetricNames(metricNames, missing)
+		c.lookupLastSeen(ctx, result, flattenMetricNames(missingNames, target.Expanded), latest)
+		message = fmt.Sprintf(
+			"Metrics have been detected as disrupted for over %s on host '%s' with the provider '%s', exceeding the %s threshold. The inspected metric(s) is/are [%s], and the missing metric(s) is/are [%s]."+
+				"To verify the exact situation, please check the posting status of the host's metrics.",
+			threshold,
+			host.ID,
+			provider,
+			status,
+			strings.Join(metricNames, ", "),
+			strings.Join(describeLastSeen(missingNames, target.Expanded, result.LastSeen, "no data points found"), ", "),
+		)
+	}
+
+	result.Report = &mackerel.CheckReport{
+		Source:     mackerel.NewCheckSourceHost(host.ID),
+		Name:       fmt.Sprint("Ikesu Check(rule=", rule.Name, ")"),
+		Status:     status,
+		Message:    message,
+		OccurredAt: checkedAt,
+	}
+	return result
+}
+
+// ruleSummary is the result of a rule classified by the outcome.
+// Interrupted is the sources in which disruptions were detected, and Unknown is the sources whose status could not be determined due to API failures.
+type ruleSummary struct {
+	Rule        string
+	OK          []string
+	Interrupted []string
+	Unknown     []string
+	Skipped     []string
+}
+
+func (s *ruleSummary) add(id string, status mackerel.CheckStatus) {
+	switch status {
+	case mackerel.CheckStatusOK:
+		s.OK = append(s.OK, id)
+	case mackerel.CheckStatusUnknown:
+		s.Unknown = append(s.Unknown, id)
+	default:
+		s.Interrupted = append(s.Interrupted, id)
+	}
+}
+
+func (c *Check) logSummary(s *ruleSummary) {
+	c.Log.Info("Check summary.",
+		"rule", s.Rule,
+		"ok", len(s.OK),
+		"interrupted", s.Interrupted,
+		"unknown", s.Unknown,
+		"skipped", len(s.Skipped),
+	)
+}
+
+// metricPresence is whether a metric has been posted within an interval.
+type metricPresence int
+
+const (
+	metricMissing metricPresence = iota
+	metricPosted
+	// metricUndetermined means that it could not be determined due to an API failure.
+	metricUndetermined
+)
+
+// presenceOf returns the presence of each of the metric names, where count returns the number of values posted for an expanded name.
+// A metric name is posted if any of its expanded names has been posted.
+// If a pattern could not be expanded (expandErr) or count fails, the metric name is undetermined unless another expanded name has been posted.
+func presenceOf(metricNames []string, expanded map[string][]string, expandErr error, count func(name string) (int, error)) ([]metricPresence, error) {
+	presences := make([]metricPresence, len(metricNames))
+	var errs error
+	if expandErr != nil && slices.ContainsFunc(metricNames, metricname.IsPattern) {
+		errs = expandErr
+	}
+	for i, name := range metricNames {
+		if expandErr != nil && metricname.IsPattern(name) {
+			presences[i] = metricUndetermined
+		}
+		for _, e := range expanded[name] {
+			cnt, err := count(e)
+			if err != nil {
+				presences[i] = metricUndetermined
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if cnt > 0 {
+				presences[i] = metricPosted
+				break
+			}
+		}
+	}
+	return presences, errs
+}
+
+// judgeStatus returns the check status, the threshold that has been exceeded and the indices of the metrics that have not been posted.
+// presenceWithin returns the presence of each metric within the given interval (in seconds).
+// It is OK if at least required metrics have been posted.
+// If the warning threshold is specified, the shorter interval is inspected first, so that the longer one is only fetched when necessary.
+// If the result depends on metrics that could not be determined, CheckStatusUnknown is returned along with the error.
+func judgeStatus(warning, critical config.InterruptedInterval, required int, presenceWithin func(interval int32) ([]metricPresence, error)) (mackerel.CheckStatus, config.InterruptedInterval, []int, error) {
+	judge := func(interval config.InterruptedInterval) (bool, []int, error) {
+		presences, err := presenceWithin(interval.ToValue())
+		posted, undetermined := 0, 0
+		missing := make([]int, 0)
+		for i, p := range presences {
+			switch p {
+			case metricPosted:
+				posted++
+			case metricUndetermined:
+				undetermined++
+			default:
+				missing = append(missing, i)
+			}
+		}
+		if posted >= required {
+			return true, nil, nil
+		}
+		if posted+undetermined >= required {
+			return false, nil, err
+		}
+		return false, missing, nil
+	}
+
+	if warning != "" {
+		ok, missing, err := judge(warning)
+		if ok {
+			return mackerel.CheckStatusOK, "", nil, nil
+		} else if err != nil {
+			return mackerel.CheckStatusUnknown, "", nil, err
+		}
+		ok, criticalMissing, err := judge(critical)
+		if ok {
+			return mackerel.CheckStatusWarning, warning, missing, nil
+		} else if err != nil {
+			return mackerel.CheckStatusUnknown, "", nil, err
+		}
+		return mackerel.CheckStatusCritical, critical, criticalMissing, nil
+	}
+	ok, missing, err := judge(critical)
+	if ok {
+		return mackerel.CheckStatusOK, "", nil, nil
+	} else if err != nil {
+		return mackerel.CheckStatusUnknown, "", nil, err
+	}
+	return mackerel.CheckStatusCritical, critical, missing, nil
+}
+
+// describeLastSeen returns each of the metric names along with the time of the newest data point found among its expanded names.
+// The metric names without any data point found are described with notFound.
+func describeLastSeen(metricNames []string, expanded map[string][]string, lastSeen map[string]int64, notFound string) []string {
+	described := make([]string, 0, len(metricNames))
+	for _, name := range metricNames {
+		seen := int64(0)
+		for _, e := range expanded[name] {
+			seen = max(seen, lastSeen[e])
+		}
+		if seen > 0 {
+			described = append(described, fmt.Sprintf("%s (last seen at %s)", name, formatTime(seen)))
+		} else {
+			described = append(described, fmt.Sprintf("%s (%s)", name, notFound))
+		}
+	}
+	return described
+}
+
+// pickMetricNames returns the metric names at the indices.
+func pickMetricNames(metricNames []string, indices []int) []string {
+	picked := make([]string, 0, len(indices))
+	for _, i := range indices {
+		picked = append(picked, metricNames[i])
+	}
+	return picked
+}
+
+// newLimiter returns a token-bucket limiter that allows the number of requests per second. If rps is 0 or less, it returns nil.
+func newLimiter(rps float64) *rate.Limiter {
+	if rps <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(rps), max(1, int(rps)))
 }
 
 // judge whether it is running on AWS Lambda.
@@ -233,6 +633,14 @@ func showProvidersInspectionMetricMap() {
 	}
 }
 
+// hostName returns the display name of the host if it is set, otherwise the host name.
+func hostName(h *mackerel.Host) string {
+	if h.DisplayName != "" {
+		return h.DisplayName
+	}
+	return h.Name
+}
+
 // see constants.providersInspectionMetricMap
 func getHostProviderType(h *mackerel.Host) string {
 	pType := make([]string, 0)
@@ -254,8 +662,18 @@ func getHostProviderType(h *mackerel.Host) string {
 	return strings.Join(pType, "-")
 }
 
-func (c *Check) retrieveMetricsCount(ctx *context.Context, hostId, metricName string, interval int32) (int, error) {
-	var values []mackerel.MetricValue
+// retrieveMetricsCount returns the number of metric values posted within the interval and the time of the newest one.
+func (c *Check) retrieveMetricsCount(ctx *context.Context, hostId, metricName string, interval int32) (int, int64, error) {
+	fetch := func(from, to int64) ([]mackerel.MetricValue, error) {
+		return c.Client.FetchHostMetricValues(hostId, metricName, from, to)
+	}
+	return c.scanMetricValues(*ctx, fetch, interval, "FetchHostMetricValues", "hostId", hostId, "metricName", metricName)
+}
+
+// scanMetricValues counts the metric values posted within the interval, fetching them in windows of constants.METRIC_INTERVAL_1MIN.
+// It also returns the time of the newest value, or 0 if there is none.
+func (c *Check) scanMetricValues(ctx context.Context, fetch func(from, to int64) ([]mackerel.MetricValue, error), interval int32, api string, attrs ...any) (int, int64, error) {
+	count, lastSeen := 0, int64(0)
 	now := time.Now().Unix()
 	from := now - int64(interval)
 	to := int64(0)
@@ -265,19 +683,25 @@ func (c *Check) retrieveMetricsCount(ctx *context.Context, hostId, metricName st
 		if to > now {
 			to = now
 		}
-		mv, err := c.Client.FetchHostMetricValues(hostId, metricName, from, to)
-		// TODO: Isn't there a better way than checking with comparisons or Contains?
-		if err != nil && strings.Contains(err.Error(), "metric not found") {
+		var mv []mackerel.MetricValue
+		err := c.callAPI(ctx, func() (err error) {
+			mv, err = fetch(from, to)
+			return err
+		})
+		args := append(slices.Clone(attrs), "from", from, "to", to)
+		if isMetricNotFound(err) {
 			// If 'metric not found' error is returned from the API, it will be skipped.
-			c.Log.Info("FetchHostMetricValues returns metric not found", "hostId", hostId, "metricName", metricName, "from", from, "to", to)
+			c.Log.Info(api+" returns metric not found", args...)
 		} else if err != nil {
-			c.Log.Error("FetchHostMetricValues returns error", "hostId", hostId, "metricName", metricName, "from", from, "to", to, "reason", err.Error())
-			return 0, err
+			c.Log.Error(api+" returns error", append(args, "reason", err.Error())...)
+			return 0, 0, err
 		} else {
-			values = append(values, mv...)
+			count += len(mv)
+			for _, v := range mv {
+				lastSeen = max(lastSeen, v.Time)
+			}
 		}
 		from = to
-		time.Sleep(200)
 	}
-	return len(values), nil
+	return count, lastSeen, nil
 }
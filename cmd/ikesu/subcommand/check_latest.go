@@ -0,0 +1,111 @@
+package subcommand
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+)
+
+// latestMetricValuesBatchSize is the number of hosts requested at once from the latest metric values API.
+const latestMetricValuesBatchSize = 100
+
+// fetchLatestMetricValues fetches the latest metric values of the targets in batches.
+// Hosts that inspect the same metric names are batched together, so that the request is not multiplied by unrelated metric names.
+// A batch that fails is only logged, and those hosts fall back to scanning the windows.
+func (c *Check) fetchLatestMetricValues(ctx context.Context, targets []*hostTarget) mackerel.LatestMetricValues {
+	type batch struct {
+		hostIDs     []string
+		metricNames []string
+	}
+	groups := make(map[string]*batch)
+	var batches []*batch
+	for _, target := range targets {
+		if target.Skipped {
+			continue
+		}
+		names := target.inspectedNames()
+		if len(names) == 0 {
+			continue
+		}
+		slices.Sort(names)
+		key := strings.Join(names, "\n")
+		b, ok := groups[key]
+		if !ok || len(b.hostIDs) >= latestMetricValuesBatchSize {
+			b = &batch{metricNames: slices.Compact(names)}
+			groups[key] = b
+			batches = append(batches, b)
+		}
+		b.hostIDs = append(b.hostIDs, target.Host.ID)
+	}
+
+	fetched := parallelMap(c.Concurrency, batches, func(b *batch) mackerel.LatestMetricValues {
+		var values mackerel.LatestMetricValues
+		err := c.callAPI(ctx, func() (err error) {
+			values, err = c.Client.FetchLatestMetricValues(b.hostIDs, b.metricNames)
+			return err
+		})
+		if err != nil {
+			c.Log.Warn("FetchLatestMetricValues returns error, so these hosts will be inspected by scanning the windows.", "hosts", len(b.hostIDs), "reason", err.Error())
+			return nil
+		}
+		return values
+	})
+
+	latest := make(mackerel.LatestMetricValues)
+	for _, values := range fetched {
+		for hostID, metrics := range values {
+			latest[hostID] = metrics
+		}
+	}
+	return latest
+}
+
+// countHostMetricValues returns the number of metric values posted within the interval and the time of the newest one.
+// If the latest metric value of the host is available, it is judged by its timestamp alone,
+// otherwise it falls back to scanning the windows.
+func (c *Check) countHostMetricValues(ctx context.Context, hostID, metricName string, interval int32, latest mackerel.LatestMetricValues) (int, int64, error) {
+	if v := latest[hostID][metricName]; v != nil && v.Time > 0 {
+		if time.Now().Unix()-v.Time <= int64(interval) {
+			return 1, v.Time, nil
+		}
+		return 0, v.Time, nil
+	}
+	return c.retrieveMetricsCount(&ctx, hostID, metricName, interval)
+}
+
+// lookupLastSeen records the time of the latest value of each of the metric names whose data point was not found while inspecting,
+// so that it can be told how long the metrics have been disrupted.
+// The values already fetched by the latest strategy are used if available. A failure is only logged, since it does not affect the status.
+func (c *Check) lookupLastSeen(ctx context.Context, result *checkResult, metricNames []string, latest mackerel.LatestMetricValues) {
+	names := make([]string, 0, len(metricNames))
+	for _, name := range metricNames {
+		if _, ok := result.LastSeen[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	values, ok := latest[result.HostID]
+	if !ok {
+		var fetched mackerel.LatestMetricValues
+		err := c.callAPI(ctx, func() (err error) {
+			fetched, err = c.Client.FetchLatestMetricValues([]string{result.HostID}, names)
+			return err
+		})
+		if err != nil {
+			c.Log.Warn("Failed to retrieve the latest metric values to determine when the metrics were last seen.", "host", result.HostID, "reason", err.Error())
+			return
+		}
+		values = fetched[result.HostID]
+	}
+	for _, name := range names {
+		if v := values[name]; v != nil && v.Time > 0 {
+			result.observe(name, 0, v.Time)
+		}
+	}
+}
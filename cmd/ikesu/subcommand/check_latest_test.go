@@ -0,0 +1,84 @@
+package subcommand
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+func TestFetchLatestMetricValues(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		values := map[string]map[string]*mackerel.MetricValue{}
+		for _, hostID := range r.URL.Query()["hostId"] {
+			values[hostID] = map[string]*mackerel.MetricValue{}
+			for _, name := range r.URL.Query()["name"] {
+				values[hostID][name] = &mackerel.MetricValue{Name: name, Time: 1700000000, Value: 1}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"tsdbLatest": values})
+	}))
+	defer ts.Close()
+
+	client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+	l, _ := logger.NewLogger("", "error", false)
+	c := &Check{Client: client, Concurrency: 2, Logger: l}
+
+	var targets []*hostTarget
+	for i := 0; i < 150; i++ {
+		targets = append(targets, newLiteralTarget(fmt.Sprintf("ec2-%d", i), "custom.a"))
+	}
+	targets = append(targets,
+		newLiteralTarget("rds-0", "custom.b"),
+		&hostTarget{Host: &mackerel.Host{ID: "skipped"}, Skipped: true},
+	)
+
+	latest := c.fetchLatestMetricValues(context.TODO(), targets)
+	// 2 batches for 150 hosts of "custom.a" and 1 batch for "custom.b".
+	assert.Equal(t, int32(3), requests.Load())
+	assert.Len(t, latest, 151)
+	assert.Equal(t, int64(1700000000), latest["ec2-149"]["custom.a"].Time)
+	assert.Nil(t, latest["rds-0"]["custom.a"])
+	assert.NotNil(t, latest["rds-0"]["custom.b"])
+}
+
+func TestCountHostMetricValuesWithLatest(t *testing.T) {
+	now := time.Now().Unix()
+	latest := mackerel.LatestMetricValues{
+		"host": {
+			"recent": &mackerel.MetricValue{Time: now - 60},
+			"stale":  &mackerel.MetricValue{Time: now - 60*60*48},
+		},
+	}
+	c := &Check{}
+
+	cnt, lastSeen, err := c.countHostMetricValues(context.TODO(), "host", "recent", 60*60*24, latest)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, now-60, lastSeen)
+
+	// A latest value older than the interval is enough to judge it as disrupted without scanning.
+	cnt, lastSeen, err = c.countHostMetricValues(context.TODO(), "host", "stale", 60*60*24, latest)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cnt)
+	assert.Equal(t, now-60*60*48, lastSeen)
+}
+
+func newLiteralTarget(hostID string, metricNames ...string) *hostTarget {
+	expanded := make(map[string][]string)
+	for _, name := range metricNames {
+		expanded[name] = []string{name}
+	}
+	return &hostTarget{Host: &mackerel.Host{ID: hostID}, MetricNames: metricNames, Expanded: expanded}
+}
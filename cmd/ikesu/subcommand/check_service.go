@@ -0,0 +1,144 @@
+package subcommand
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/constants"
+)
+
+// maxLookBack is how far back in seconds the service metrics are looked up to determine when they were last seen.
+const maxLookBack = constants.MAX_INTERRUPTED_INTERVAL
+
+// checkServiceRules inspects the service metrics according to the service check rules and returns the results.
+// Since the check monitoring API only accepts a host as the source, the reports are posted to the host specified in the rule.
+// The rules are inspected concurrently, and the results are returned in the order of the rules.
+func (c *Check) checkServiceRules(ctx context.Context, rules []config.ServiceMetricCheckRule, checkedAt int64) []*checkResult {
+	results := parallelMap(c.Concurrency, rules, func(rule config.ServiceMetricCheckRule) *checkResult {
+		return c.inspectService(ctx, rule, checkedAt)
+	})
+	for i, result := range results {
+		summary := &ruleSummary{Rule: result.Rule}
+		summary.add(rules[i].Service, result.Status)
+		c.logSummary(summary)
+	}
+	return results
+}
+
+func (c *Check) inspectService(ctx context.Context, rule config.ServiceMetricCheckRule, checkedAt int64) *checkResult {
+	c.Log.Info("ServiceCheckRule", "name", rule.Name, "service", rule.Service)
+
+	expanded, expandErr := c.expandMetricNames(ctx, rule.InspectionMetrics, func() ([]string, error) {
+		return c.Client.ListServiceMetricNames(rule.Service)
+	})
+	if expandErr != nil {
+		c.Log.Error("Failed to retrieve the metric names to expand the patterns.", "service", rule.Service, "reason", expandErr.Error())
+	}
+
+	result := &checkResult{
+		Rule:     rule.Name,
+		HostID:   rule.ReportHostID,
+		Provider: "service",
+		Metrics:  flattenMetricNames(rule.InspectionMetrics, expanded),
+	}
+	presenceWithin := func(interval int32) ([]metricPresence, error) {
+		result.Points = 0
+		return presenceOf(rule.InspectionMetrics, expanded, expandErr, func(name string) (int, error) {
+			cnt, lastSeen, err := c.retrieveServiceMetricsCount(&ctx, rule.Service, name, interval)
+			if err != nil {
+				c.Log.Error(fmt.Sprintf("Failed to retrieve the metric '%s' for service '%s'.", name, rule.Service), "reason", err.Error())
+			}
+			result.observe(name, cnt, lastSeen)
+			return cnt, err
+		})
+	}
+	warning, critical := rule.Thresholds()
+	status, threshold, missing, err := judgeStatus(warning, critical, rule.RequiredMetrics(len(rule.InspectionMetrics)), presenceWithin)
+	result.Status = status
+
+	message := ""
+	switch status {
+	case mackerel.CheckStatusOK:
+		message = "No disruptions were detected in the service metrics."
+	case mackerel.CheckStatusUnknown:
+		if rule.OnAPIError.Skip() {
+			c.Log.Warn("Skipping the report because the posting status could not be determined.", "service", rule.Service, "reason", err.Error())
+			return result
+		}
+		message = fmt.Sprintf(
+			"The posting status of the service metrics on service '%s' could not be determined due to a failure of the Mackerel API. The inspected metric(s) is/are [%s]. reason: %s",
+			rule.Service,
+			strings.Join(rule.InspectionMetrics, ", "),
+			err.Error(),
+		)
+	default:
+		missingNames := pickMetricNames(rule.InspectionMetrics, missing)
+		c.lookupServiceLastSeen(ctx, rule.Service, result, flattenMetricNames(missingNames, expanded), critical.ToValue())
+		message = fmt.Sprintf(
+			"Service metrics have been detected as disrupted for over %s on service '%s', exceeding the %s threshold. The inspected metric(s) is/are [%s], and the missing metric(s) is/are [%s]."+
+				"To verify the exact situation, please check the posting status of the service's metrics.",
+			threshold,
+			rule.Service,
+			status,
+			strings.Join(rule.InspectionMetrics, ", "),
+			strings.Join(describeLastSeen(missingNames, expanded, result.LastSeen, fmt.Sprintf("not seen within %dh", maxLookBack/3600)), ", "),
+		)
+	}
+
+	result.Report = &mackerel.CheckReport{
+		Source:     mackerel.NewCheckSourceHost(rule.ReportHostID),
+		Name:       fmt.Sprint("Ikesu Service Check(rule=", rule.Name, ")"),
+		Status:     status,
+		Message:    message,
+		OccurredAt: checkedAt,
+	}
+	return result
+}
+
+// retrieveServiceMetricsCount returns the number of service metric values posted within the interval and the time of the newest one.
+func (c *Check) retrieveServiceMetricsCount(ctx *context.Context, serviceName, metricName string, interval int32) (int, int64, error) {
+	fetch := func(from, to int64) ([]mackerel.MetricValue, error) {
+		return c.Client.FetchServiceMetricValues(serviceName, metricName, from, to)
+	}
+	return c.scanMetricValues(*ctx, fetch, interval, "FetchServiceMetricValues", "service", serviceName, "metricName", metricName)
+}
+
+// lookupServiceLastSeen looks up when the missing service metrics were last posted before the interval, since the values
+// are fetched only within it and there is no API to retrieve the latest values of the service metrics.
+// The windows are scanned backward up to maxLookBack, and stop at the newest window in which the metric is found.
+func (c *Check) lookupServiceLastSeen(ctx context.Context, serviceName string, result *checkResult, metricNames []string, interval int32) {
+	now := time.Now().Unix()
+	limit := now - int64(maxLookBack)
+	for _, name := range metricNames {
+		if _, ok := result.LastSeen[name]; ok {
+			continue
+		}
+		for to := now - int64(interval); to > limit; to -= constants.METRIC_INTERVAL_1MIN {
+			from := max(to-constants.METRIC_INTERVAL_1MIN, limit)
+			var mv []mackerel.MetricValue
+			err := c.callAPI(ctx, func() (err error) {
+				mv, err = c.Client.FetchServiceMetricValues(serviceName, name, from, to)
+				return err
+			})
+			if err != nil {
+				if !isMetricNotFound(err) {
+					c.Log.Warn("Failed to retrieve the service metric values to determine when the metric was last seen.", "service", serviceName, "metricName", name, "reason", err.Error())
+				}
+				break
+			}
+			if len(mv) > 0 {
+				lastSeen := int64(0)
+				for _, v := range mv {
+					lastSeen = max(lastSeen, v.Time)
+				}
+				result.observe(name, 0, lastSeen)
+				break
+			}
+		}
+	}
+}
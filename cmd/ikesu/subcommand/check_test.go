@@ -1,10 +1,22 @@
 package subcommand
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mackerelio/mackerel-client-go"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/fakemackerel"
+	"github.com/tukaelu/ikesu/internal/logger"
 )
 
 func TestGetHostProviderType(t *testing.T) {
@@ -44,6 +56,145 @@ func TestGetHostProviderType(t *testing.T) {
 	}
 }
 
+func TestJudgeStatus(t *testing.T) {
+	// lastPosted is the elapsed time in seconds since each metric was last posted. A negative value means it has never been posted.
+	presenceWithin := func(lastPosted []int32) func(int32) ([]metricPresence, error) {
+		return func(interval int32) ([]metricPresence, error) {
+			presences := make([]metricPresence, len(lastPosted))
+			for i, p := range lastPosted {
+				if p >= 0 && p <= interval {
+					presences[i] = metricPosted
+				}
+			}
+			return presences, nil
+		}
+	}
+	const hour = 60 * 60
+	cases := []struct {
+		name       string
+		warning    config.InterruptedInterval
+		critical   config.InterruptedInterval
+		required   int
+		lastPosted []int32
+		status     mackerel.CheckStatus
+		threshold  config.InterruptedInterval
+		missing    []int
+	}{
+		{name: "ok", critical: "24h", required: 1, lastPosted: []int32{60}, status: mackerel.CheckStatusOK},
+		{name: "critical", critical: "24h", required: 1, lastPosted: []int32{-1}, status: mackerel.CheckStatusCritical, threshold: "24h", missing: []int{0}},
+		{name: "staged ok", warning: "6h", critical: "24h", required: 1, lastPosted: []int32{60}, status: mackerel.CheckStatusOK},
+		{name: "staged warning", warning: "6h", critical: "24h", required: 1, lastPosted: []int32{12 * hour}, status: mackerel.CheckStatusWarning, threshold: "6h", missing: []int{0}},
+		{name: "staged critical", warning: "6h", critical: "24h", required: 1, lastPosted: []int32{-1}, status: mackerel.CheckStatusCritical, threshold: "24h", missing: []int{0}},
+		{name: "any of them", critical: "24h", required: 1, lastPosted: []int32{-1, 60, -1}, status: mackerel.CheckStatusOK},
+		{name: "all of them", critical: "24h", required: 3, lastPosted: []int32{60, 60, 60}, status: mackerel.CheckStatusOK},
+		{ // A single missing metric is enough to alert if all of them are required.
+			name: "one of all is missing", critical: "24h", required: 3, lastPosted: []int32{60, -1, 60}, status: mackerel.CheckStatusCritical, threshold: "24h", missing: []int{1},
+		},
+		{name: "min_present", critical: "24h", required: 2, lastPosted: []int32{60, -1, 60}, status: mackerel.CheckStatusOK},
+		{
+			name: "staged all", warning: "6h", critical: "24h", required: 2, lastPosted: []int32{60, 12 * hour}, status: mackerel.CheckStatusWarning, threshold: "6h", missing: []int{1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, threshold, missing, err := judgeStatus(c.warning, c.critical, c.required, presenceWithin(c.lastPosted))
+			assert.NoError(t, err)
+			assert.Equal(t, c.status, status)
+			assert.Equal(t, c.threshold, threshold)
+			assert.Equal(t, c.missing, missing)
+		})
+	}
+}
+
+func TestJudgeStatusOnAPIError(t *testing.T) {
+	apiErr := errors.New("API request failed")
+	presences := func(p ...metricPresence) func(int32) ([]metricPresence, error) {
+		return func(int32) ([]metricPresence, error) { return p, apiErr }
+	}
+
+	// Even if some retrievals fail, it is OK if enough metrics have been posted.
+	status, _, _, err := judgeStatus("", "24h", 1, presences(metricUndetermined, metricPosted))
+	assert.NoError(t, err)
+	assert.Equal(t, mackerel.CheckStatusOK, status)
+
+	// If the result depends on the failed retrieval, it is UNKNOWN rather than CRITICAL.
+	status, threshold, _, err := judgeStatus("", "24h", 1, presences(metricUndetermined, metricMissing))
+	assert.ErrorIs(t, err, apiErr)
+	assert.Equal(t, mackerel.CheckStatusUnknown, status)
+	assert.Equal(t, config.InterruptedInterval(""), threshold)
+
+	// If a metric is definitely missing when all are required, it is CRITICAL regardless of the failed retrieval.
+	status, _, missing, err := judgeStatus("", "24h", 2, presences(metricUndetermined, metricMissing))
+	assert.NoError(t, err)
+	assert.Equal(t, mackerel.CheckStatusCritical, status)
+	assert.Equal(t, []int{1}, missing)
+
+	// Found within the critical threshold, but the warning threshold could not be determined.
+	status, _, _, err = judgeStatus("6h", "24h", 1, func(interval int32) ([]metricPresence, error) {
+		if interval == 60*60*6 {
+			return []metricPresence{metricUndetermined}, apiErr
+		}
+		return []metricPresence{metricPosted}, nil
+	})
+	assert.ErrorIs(t, err, apiErr)
+	assert.Equal(t, mackerel.CheckStatusUnknown, status)
+}
+
+func TestPresenceOf(t *testing.T) {
+	apiErr := errors.New("API request failed")
+	metricNames := []string{"custom.a", "custom.nginx.*", "custom.b"}
+	expanded := map[string][]string{
+		"custom.a":       {"custom.a"},
+		"custom.nginx.*": {"custom.nginx.requests", "custom.nginx.connections"},
+		"custom.b":       {"custom.b"},
+	}
+	counts := map[string]int{"custom.a": 0, "custom.nginx.connections": 3}
+
+	presences, err := presenceOf(metricNames, expanded, nil, func(name string) (int, error) {
+		if name == "custom.b" {
+			return 0, apiErr
+		}
+		return counts[name], nil
+	})
+	assert.ErrorIs(t, err, apiErr)
+	assert.Equal(t, []metricPresence{metricMissing, metricPosted, metricUndetermined}, presences)
+
+	// The pattern that could not be expanded is undetermined.
+	presences, err = presenceOf(metricNames, map[string][]string{"custom.a": {"custom.a"}, "custom.b": {"custom.b"}}, apiErr, func(name string) (int, error) {
+		return 1, nil
+	})
+	assert.ErrorIs(t, err, apiErr)
+	assert.Equal(t, []metricPresence{metricPosted, metricUndetermined, metricPosted}, presences)
+}
+
+func TestDescribeLastSeen(t *testing.T) {
+	seen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Unix()
+	expanded := map[string][]string{
+		"custom.a":   {"custom.a"},
+		"custom.b.*": {"custom.b.x", "custom.b.y"},
+		"custom.c":   {"custom.c"},
+	}
+	lastSeen := map[string]int64{"custom.a": seen, "custom.b.x": seen - 60, "custom.b.y": seen}
+
+	described := describeLastSeen([]string{"custom.a", "custom.b.*", "custom.c"}, expanded, lastSeen, "no data points found")
+	assert.Equal(t, []string{
+		"custom.a (last seen at " + formatTime(seen) + ")",
+		"custom.b.* (last seen at " + formatTime(seen) + ")",
+		"custom.c (no data points found)",
+	}, described)
+}
+
+func TestRuleSummary(t *testing.T) {
+	s := &ruleSummary{Rule: "r"}
+	s.add("a", mackerel.CheckStatusOK)
+	s.add("b", mackerel.CheckStatusWarning)
+	s.add("c", mackerel.CheckStatusCritical)
+	s.add("d", mackerel.CheckStatusUnknown)
+	assert.Equal(t, []string{"a"}, s.OK)
+	assert.Equal(t, []string{"b", "c"}, s.Interrupted)
+	assert.Equal(t, []string{"d"}, s.Unknown)
+}
+
 func newHost(provider string, agent string) *mackerel.Host {
 	return &mackerel.Host{
 		Meta: mackerel.HostMeta{
@@ -54,3 +205,145 @@ func newHost(provider string, agent string) *mackerel.Host {
 		},
 	}
 }
+
+func TestCheckRun(t *testing.T) {
+	now := time.Now()
+	server := fakemackerel.NewServer()
+	fixture := &fakemackerel.Fixture{
+		Services: []fakemackerel.FixtureService{{Name: "blog", Roles: []string{"web", "db"}}},
+		Hosts: []fakemackerel.FixtureHost{
+			{ID: "alive", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "5m"},
+				"custom.nginx.requests":                   {LastPosted: "5m"},
+			}},
+			{ID: "stale", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "12h"},
+			}},
+			{ID: "dead", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "48h"},
+			}},
+			{ID: "db", Roles: map[string][]string{"blog": {"db"}}, Provider: "rds"},
+		},
+		ServiceMetrics: map[string]map[string]fakemackerel.Series{
+			"blog": {"kpi.orders": {LastPosted: "1h"}, "kpi.signups": {LastPosted: "12h"}},
+		},
+	}
+	assert.NoError(t, server.Load(fixture, now))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	run := func(t *testing.T, conf *config.CheckConfig) map[string]fakemackerel.Report {
+		t.Helper()
+		client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+		l, _ := logger.NewLogger("", "error", false)
+		c := &Check{Config: conf, Client: client, Concurrency: 2, Logger: l}
+		before := len(server.Reports())
+		assert.NoError(t, c.Run(context.TODO()))
+		reports := make(map[string]fakemackerel.Report)
+		for _, r := range server.Reports()[before:] {
+			reports[r.Source.HostID+"/"+r.Name] = r
+		}
+		return reports
+	}
+
+	for _, strategy := range []config.Strategy{config.StrategyWindow, config.StrategyLatest} {
+		t.Run("staged thresholds with "+string(strategy), func(t *testing.T) {
+			reports := run(t, &config.CheckConfig{Rules: []config.MetricCheckRule{
+				{Name: "web", Service: "blog", Roles: []string{"web"}, WarningInterval: "6h", CriticalInterval: "24h", Strategy: strategy},
+			}})
+			assert.Len(t, reports, 3)
+			assert.Equal(t, "OK", reports["alive/Ikesu Check(rule=web)"].Status)
+			assert.Equal(t, "WARNING", reports["stale/Ikesu Check(rule=web)"].Status)
+			assert.Equal(t, "CRITICAL", reports["dead/Ikesu Check(rule=web)"].Status)
+			assert.Contains(t, reports["dead/Ikesu Check(rule=web)"].Message, "exceeding the CRITICAL threshold")
+			// The time when the metric was last posted is looked up even if it is out of the interval.
+			assert.Contains(t, reports["dead/Ikesu Check(rule=web)"].Message,
+				"custom.ec2.status_check_failed.instance (last seen at "+formatTime(now.Add(-48*time.Hour).Unix())+")")
+			assert.Contains(t, reports["stale/Ikesu Check(rule=web)"].Message,
+				"custom.ec2.status_check_failed.instance (last seen at "+formatTime(now.Add(-12*time.Hour).Unix())+")")
+		})
+	}
+
+	t.Run("all metrics required with a wildcard", func(t *testing.T) {
+		reports := run(t, &config.CheckConfig{Rules: []config.MetricCheckRule{
+			{
+				Name: "web", Service: "blog", Roles: []string{"web"}, InterruptedInterval: "24h", Match: config.MatchAll,
+				InspectionMetrics: map[string][]string{"ec2": {"custom.nginx.*"}},
+			},
+		}})
+		assert.Equal(t, "OK", reports["alive/Ikesu Check(rule=web)"].Status)
+		assert.Equal(t, "CRITICAL", reports["stale/Ikesu Check(rule=web)"].Status)
+		assert.Contains(t, reports["stale/Ikesu Check(rule=web)"].Message, "the missing metric(s) is/are [custom.nginx.* (no data points found)]")
+	})
+
+	t.Run("service rules", func(t *testing.T) {
+		reports := run(t, &config.CheckConfig{ServiceRules: []config.ServiceMetricCheckRule{
+			{Name: "kpi", Service: "blog", InterruptedInterval: "6h", InspectionMetrics: []string{"kpi.*"}, ReportHostID: "alive"},
+			{Name: "gone", Service: "blog", InterruptedInterval: "6h", InspectionMetrics: []string{"kpi.users"}, ReportHostID: "alive"},
+			{Name: "stale", Service: "blog", InterruptedInterval: "6h", InspectionMetrics: []string{"kpi.signups"}, ReportHostID: "alive"},
+		}})
+		assert.Equal(t, "OK", reports["alive/Ikesu Service Check(rule=kpi)"].Status)
+		assert.Equal(t, "CRITICAL", reports["alive/Ikesu Service Check(rule=gone)"].Status)
+		assert.Contains(t, reports["alive/Ikesu Service Check(rule=gone)"].Message, "[kpi.users (not seen within 720h)]")
+		// The time when the service metric was last posted is looked up even if it is out of the interval.
+		assert.Equal(t, "CRITICAL", reports["alive/Ikesu Service Check(rule=stale)"].Status)
+		assert.Contains(t, reports["alive/Ikesu Service Check(rule=stale)"].Message,
+			"[kpi.signups (last seen at "+formatTime(now.Add(-12*time.Hour).Unix())+")]")
+	})
+
+	t.Run("unknown on API failures", func(t *testing.T) {
+		server.FailWith("/api/v0/hosts/dead/metrics", http.StatusInternalServerError)
+		defer server.FailWith("/api/v0/hosts/dead/metrics", 0)
+
+		reports := run(t, &config.CheckConfig{Rules: []config.MetricCheckRule{
+			{Name: "web", Service: "blog", Roles: []string{"web"}, InterruptedInterval: "24h"},
+			{Name: "skip", Service: "blog", Roles: []string{"web"}, InterruptedInterval: "24h", OnAPIError: config.OnAPIErrorSkip},
+		}})
+		assert.Equal(t, "UNKNOWN", reports["dead/Ikesu Check(rule=web)"].Status)
+		assert.NotContains(t, reports, "dead/Ikesu Check(rule=skip)")
+		assert.Equal(t, "OK", reports["alive/Ikesu Check(rule=skip)"].Status)
+	})
+
+	t.Run("dry-run displays the results without posting", func(t *testing.T) {
+		client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+		l, _ := logger.NewLogger("", "error", true)
+		var out bytes.Buffer
+		c := &Check{
+			Config: &config.CheckConfig{Rules: []config.MetricCheckRule{
+				{Name: "web", Service: "blog", Roles: []string{"web"}, InterruptedInterval: "24h"},
+			}},
+			Client: client, DryRun: true, Output: outputJSON, Out: &out, Concurrency: 2, Logger: l,
+		}
+		before := len(server.Reports())
+		assert.NoError(t, c.Run(context.TODO()))
+		assert.Len(t, server.Reports(), before)
+
+		var rows []resultRow
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &rows))
+		assert.Len(t, rows, 3)
+		for _, row := range rows {
+			assert.Equal(t, "ec2", row.Provider)
+			switch row.HostID {
+			case "alive":
+				assert.Equal(t, "OK", row.Status)
+				assert.Positive(t, row.Points)
+				assert.NotEmpty(t, row.LastSeen)
+			case "dead":
+				assert.Equal(t, "CRITICAL", row.Status)
+				assert.Zero(t, row.Points)
+				assert.Equal(t, formatTime(now.Add(-48*time.Hour).Unix()), row.LastSeen)
+			}
+		}
+	})
+
+	t.Run("the reports are posted in batches of 100", func(t *testing.T) {
+		rules := make([]config.ServiceMetricCheckRule, 0, 150)
+		for i := 0; i < 150; i++ {
+			rules = append(rules, config.ServiceMetricCheckRule{
+				Name: fmt.Sprintf("kpi-%d", i), Service: "blog", InterruptedInterval: "6h", InspectionMetrics: []string{"kpi.orders"}, ReportHostID: "alive",
+			})
+		}
+		reports := run(t, &config.CheckConfig{ServiceRules: rules})
+		assert.Len(t, reports, 150)
+	})
+}
@@ -0,0 +1,106 @@
+package subcommand
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+// NewConfigCommand returns a command group to work with the configuration. Only verify accesses the Mackerel API.
+func NewConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Validates the configuration, verifies it against the organization, or prints its JSON Schema.",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "validate",
+				Usage:     "Validates the configuration offline, and reports every problem found.",
+				UsageText: "ikesu config validate -config <config file> [-config <config file>...]",
+				Action: func(ctx *cli.Context) error {
+					conf, err := config.NewCheckConfig(ctx.Context, ctx.StringSlice("config")...)
+					if err != nil {
+						return err
+					}
+					if err := conf.Validate(); err != nil {
+						return err
+					}
+					fmt.Fprintf(ctx.App.Writer, "The configuration is valid. (check: %d, service_check: %d)\n", len(conf.Rules), len(conf.ServiceRules))
+					return nil
+				},
+				Flags: []cli.Flag{requiredConfigFlag()},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Verifies the rules against the organization of Mackerel, such as the services, the roles and the posted metrics.",
+				UsageText: "ikesu config verify -config <config file> [-config <config file>...]",
+				Action: func(ctx *cli.Context) error {
+					check, err := newVerifyCheck(ctx)
+					if err != nil {
+						return err
+					}
+					findings, err := check.verify(ctx.Context)
+					if err != nil {
+						return err
+					}
+					for _, f := range findings {
+						fmt.Fprintln(ctx.App.Writer, f.String())
+					}
+					if len(findings) > 0 {
+						return fmt.Errorf("%d problems were found in the configuration.", len(findings))
+					}
+					fmt.Fprintf(ctx.App.Writer, "The configuration has been verified. (check: %d, service_check: %d)\n", len(check.Config.Rules), len(check.Config.ServiceRules))
+					return nil
+				},
+				Flags: append([]cli.Flag{requiredConfigFlag()}, apiFlags()...),
+			},
+			{
+				Name:      "schema",
+				Usage:     "Prints the JSON Schema of the configuration for the editors and CI.",
+				UsageText: "ikesu config schema > ikesu.schema.json",
+				Action: func(ctx *cli.Context) error {
+					buf, err := config.NewJSONSchema().MarshalIndent()
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(ctx.App.Writer, string(buf))
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func requiredConfigFlag() cli.Flag {
+	f := configFlag()
+	f.Required = true
+	return f
+}
+
+// newVerifyCheck returns a Check to verify the configuration, in which the logs are written to stderr unless the log file is specified.
+func newVerifyCheck(ctx *cli.Context) (*Check, error) {
+	l, err := logger.NewLogger(ctx.String("log"), ctx.String("log-level"), true)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := config.NewCheckConfig(ctx.Context, ctx.StringSlice("config")...)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Check{
+		Config:      conf,
+		Client:      client,
+		Limiter:     newLimiter(ctx.Float64("api-rate-limit")),
+		Concurrency: ctx.Int("concurrency"),
+		Logger:      l,
+	}, nil
+}
@@ -0,0 +1,50 @@
+package subcommand
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func runConfigCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	app := &cli.App{
+		Name:     "ikesu",
+		Writer:   &out,
+		Commands: []*cli.Command{NewConfigCommand()},
+	}
+	err := app.Run(append([]string{"ikesu", "config"}, args...))
+	return out.String(), err
+}
+
+func TestConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yml")
+	assert.NoError(t, os.WriteFile(valid, []byte("check:\n  - name: web\n    service: blog\n"), 0644))
+	invalid := filepath.Join(dir, "invalid.yml")
+	assert.NoError(t, os.WriteFile(invalid, []byte("check:\n  - name: web\n    interrupted_interval: 1h\n    critical_interval: 2h\n"), 0644))
+
+	out, err := runConfigCommand(t, "validate", "--config", valid)
+	assert.NoError(t, err)
+	assert.Equal(t, "The configuration is valid. (check: 1, service_check: 0)\n", out)
+
+	_, err = runConfigCommand(t, "validate", "--config", invalid)
+	assert.ErrorContains(t, err, "Service not specified for check 'web'.")
+	assert.ErrorContains(t, err, "Both interrupted_interval and critical_interval are specified for check 'web'.")
+}
+
+func TestConfigSchema(t *testing.T) {
+	out, err := runConfigCommand(t, "schema")
+	assert.NoError(t, err)
+
+	var schema map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(out), &schema))
+	assert.Contains(t, schema["properties"], "check")
+	assert.Contains(t, schema["properties"], "service_check")
+}
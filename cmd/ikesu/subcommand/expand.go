@@ -0,0 +1,45 @@
+package subcommand
+
+import (
+	"context"
+	"slices"
+
+	"github.com/tukaelu/ikesu/internal/metricname"
+)
+
+// expandMetricNames returns the metric names to be inspected for each of the specified names, in which the patterns are expanded with the names returned by list.
+// list is called only if any of them is a pattern. If it fails, the patterns are expanded to nothing and the error is returned along with the literal names.
+func (c *Check) expandMetricNames(ctx context.Context, metricNames []string, list func() ([]string, error)) (map[string][]string, error) {
+	expanded := make(map[string][]string, len(metricNames))
+
+	var names []string
+	var err error
+	if slices.ContainsFunc(metricNames, metricname.IsPattern) {
+		err = c.callAPI(ctx, func() (err error) {
+			names, err = list()
+			return err
+		})
+	}
+	for _, name := range metricNames {
+		if err != nil && metricname.IsPattern(name) {
+			expanded[name] = nil
+			continue
+		}
+		// The patterns have already been validated, so the error can be ignored.
+		expanded[name], _ = metricname.Expand(name, names)
+	}
+	return expanded, err
+}
+
+// flattenMetricNames returns the unique metric names expanded from the specified names in the specified order.
+func flattenMetricNames(metricNames []string, expanded map[string][]string) []string {
+	flattened := make([]string, 0, len(metricNames))
+	for _, name := range metricNames {
+		for _, e := range expanded[name] {
+			if !slices.Contains(flattened, e) {
+				flattened = append(flattened, e)
+			}
+		}
+	}
+	return flattened
+}
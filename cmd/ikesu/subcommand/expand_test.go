@@ -0,0 +1,46 @@
+package subcommand
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+func TestExpandMetricNames(t *testing.T) {
+	l, _ := logger.NewLogger("", "error", false)
+	c := &Check{Logger: l}
+	names := []string{"custom.nginx.requests", "custom.nginx.connections", "custom.foo.bar"}
+
+	t.Run("lists the metric names only if there are patterns", func(t *testing.T) {
+		expanded, err := c.expandMetricNames(context.TODO(), []string{"custom.foo.bar"}, func() ([]string, error) {
+			t.Fatal("must not be called")
+			return nil, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{"custom.foo.bar": {"custom.foo.bar"}}, expanded)
+	})
+
+	t.Run("expands the patterns", func(t *testing.T) {
+		specified := []string{"custom.nginx.*", "custom.foo.bar", "/^custom\\.foo\\./"}
+		expanded, err := c.expandMetricNames(context.TODO(), specified, func() ([]string, error) {
+			return names, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"custom.nginx.requests", "custom.nginx.connections"}, expanded["custom.nginx.*"])
+		assert.Equal(t, []string{"custom.nginx.requests", "custom.nginx.connections", "custom.foo.bar"}, flattenMetricNames(specified, expanded))
+	})
+
+	t.Run("keeps the literal names when listing fails", func(t *testing.T) {
+		listErr := errors.New("API request failed")
+		expanded, err := c.expandMetricNames(context.TODO(), []string{"custom.nginx.*", "custom.foo.bar"}, func() ([]string, error) {
+			return nil, listErr
+		})
+		assert.ErrorIs(t, err, listErr)
+		assert.Empty(t, expanded["custom.nginx.*"])
+		assert.Equal(t, []string{"custom.foo.bar"}, expanded["custom.foo.bar"])
+	})
+}
@@ -0,0 +1,178 @@
+package subcommand
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	hostStatusOK          = "ok"
+	hostStatusInterrupted = "interrupted"
+	hostStatusUnknown     = "unknown"
+	hostStatusSkipped     = "skipped"
+)
+
+// serveMetrics is the metrics of the serve mode exposed for Prometheus, derived from the results of the evaluations.
+type serveMetrics struct {
+	registry *prometheus.Registry
+
+	hosts        *prometheus.GaugeVec
+	apiCalls     *prometheus.CounterVec
+	apiErrors    *prometheus.CounterVec
+	runDuration  *prometheus.HistogramVec
+	lastSeenAge  *prometheus.GaugeVec
+	lastRunError *prometheus.GaugeVec
+}
+
+func newServeMetrics() *serveMetrics {
+	m := &serveMetrics{
+		registry: prometheus.NewRegistry(),
+		hosts: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ikesu_rule_hosts",
+			Help: "The number of the hosts by the status in the last evaluation of the rule.",
+		}, []string{"rule", "status"}),
+		apiCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ikesu_mackerel_api_calls_total",
+			Help: "The number of the calls of the Mackerel API.",
+		}, []string{"api"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ikesu_mackerel_api_errors_total",
+			Help: "The number of the failed calls of the Mackerel API, in which 'metric not found' for the metrics without values is not counted.",
+		}, []string{"api"}),
+		runDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ikesu_rule_run_duration_seconds",
+			Help:    "The time taken to evaluate the rule.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+		}, []string{"rule"}),
+		lastSeenAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ikesu_host_last_seen_age_seconds",
+			Help: "The elapsed time since the newest data point of the inspected metrics was posted, as of the last evaluation of the rule.",
+		}, []string{"rule", "host"}),
+		lastRunError: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ikesu_rule_last_run_failed",
+			Help: "Whether the last evaluation of the rule failed (1) or not (0).",
+		}, []string{"rule"}),
+	}
+	m.registry.MustRegister(m.hosts, m.apiCalls, m.apiErrors, m.runDuration, m.lastSeenAge, m.lastRunError)
+	return m
+}
+
+func (m *serveMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observe records the run of the rule. The gauges of the rule are replaced, so that the hosts no longer matched disappear.
+func (m *serveMetrics) observe(run *ruleRun, results []*checkResult) {
+	m.runDuration.WithLabelValues(run.Rule).Observe(run.FinishedAt.Sub(run.StartedAt).Seconds())
+	if run.Error != "" {
+		m.lastRunError.WithLabelValues(run.Rule).Set(1)
+		return
+	}
+	m.lastRunError.WithLabelValues(run.Rule).Set(0)
+
+	counts := map[string]int{hostStatusOK: 0, hostStatusInterrupted: 0, hostStatusUnknown: 0, hostStatusSkipped: 0}
+	m.lastSeenAge.DeletePartialMatch(prometheus.Labels{"rule": run.Rule})
+	for _, result := range results {
+		counts[hostStatusOf(result)]++
+		if seen := result.newestSeen(); seen > 0 {
+			m.lastSeenAge.WithLabelValues(run.Rule, result.HostID).Set(run.FinishedAt.Sub(time.Unix(seen, 0)).Seconds())
+		}
+	}
+	for status, count := range counts {
+		m.hosts.WithLabelValues(run.Rule, status).Set(float64(count))
+	}
+}
+
+// forget deletes the metrics of the rule, which has been removed from the configuration.
+func (m *serveMetrics) forget(rule string) {
+	labels := prometheus.Labels{"rule": rule}
+	m.hosts.DeletePartialMatch(labels)
+	m.runDuration.DeletePartialMatch(labels)
+	m.lastSeenAge.DeletePartialMatch(labels)
+	m.lastRunError.DeletePartialMatch(labels)
+}
+
+func hostStatusOf(result *checkResult) string {
+	switch {
+	case result.Skipped:
+		return hostStatusSkipped
+	case result.Status == mackerel.CheckStatusOK:
+		return hostStatusOK
+	case result.Status == mackerel.CheckStatusUnknown:
+		return hostStatusUnknown
+	default:
+		return hostStatusInterrupted
+	}
+}
+
+// instrumentedClient counts the calls of the Mackerel API and their failures.
+// 'metric not found' is not counted as a failure, since it is returned for every disrupted metric and is not a problem of the API.
+type instrumentedClient struct {
+	MackerelClient
+	metrics *serveMetrics
+}
+
+func (c *instrumentedClient) count(api string, err error) {
+	c.metrics.apiCalls.WithLabelValues(api).Inc()
+	if err != nil && !isMetricNotFound(err) {
+		c.metrics.apiErrors.WithLabelValues(api).Inc()
+	}
+}
+
+func (c *instrumentedClient) FindServices() ([]*mackerel.Service, error) {
+	services, err := c.MackerelClient.FindServices()
+	c.count("FindServices", err)
+	return services, err
+}
+
+func (c *instrumentedClient) FindRoles(serviceName string) ([]*mackerel.Role, error) {
+	roles, err := c.MackerelClient.FindRoles(serviceName)
+	c.count("FindRoles", err)
+	return roles, err
+}
+
+func (c *instrumentedClient) FindHosts(param *mackerel.FindHostsParam) ([]*mackerel.Host, error) {
+	hosts, err := c.MackerelClient.FindHosts(param)
+	c.count("FindHosts", err)
+	return hosts, err
+}
+
+func (c *instrumentedClient) ListHostMetricNames(hostID string) ([]string, error) {
+	names, err := c.MackerelClient.ListHostMetricNames(hostID)
+	c.count("ListHostMetricNames", err)
+	return names, err
+}
+
+func (c *instrumentedClient) ListServiceMetricNames(serviceName string) ([]string, error) {
+	names, err := c.MackerelClient.ListServiceMetricNames(serviceName)
+	c.count("ListServiceMetricNames", err)
+	return names, err
+}
+
+func (c *instrumentedClient) FetchHostMetricValues(hostID, metricName string, from, to int64) ([]mackerel.MetricValue, error) {
+	values, err := c.MackerelClient.FetchHostMetricValues(hostID, metricName, from, to)
+	c.count("FetchHostMetricValues", err)
+	return values, err
+}
+
+func (c *instrumentedClient) FetchServiceMetricValues(serviceName, metricName string, from, to int64) ([]mackerel.MetricValue, error) {
+	values, err := c.MackerelClient.FetchServiceMetricValues(serviceName, metricName, from, to)
+	c.count("FetchServiceMetricValues", err)
+	return values, err
+}
+
+func (c *instrumentedClient) FetchLatestMetricValues(hostIDs, metricNames []string) (mackerel.LatestMetricValues, error) {
+	values, err := c.MackerelClient.FetchLatestMetricValues(hostIDs, metricNames)
+	c.count("FetchLatestMetricValues", err)
+	return values, err
+}
+
+func (c *instrumentedClient) PostCheckReports(reports *mackerel.CheckReports) error {
+	err := c.MackerelClient.PostCheckReports(reports)
+	c.count("PostCheckReports", err)
+	return err
+}
@@ -0,0 +1,113 @@
+package subcommand
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/fakemackerel"
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+func TestServeMetrics(t *testing.T) {
+	server := fakemackerel.NewServer()
+	fixture := &fakemackerel.Fixture{
+		Services: []fakemackerel.FixtureService{{Name: "blog", Roles: []string{"web"}}},
+		Hosts: []fakemackerel.FixtureHost{
+			{ID: "alive", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "5m"},
+			}},
+			{ID: "dead", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "48h"},
+			}},
+			{ID: "onprem", Roles: map[string][]string{"blog": {"web"}}, AgentName: "mackerel-agent/0.78.0"},
+		},
+	}
+	assert.NoError(t, server.Load(fixture, time.Now()))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+	l, _ := logger.NewLogger("", "error", false)
+	serve := &Serve{}
+	m := serve.getMetrics()
+	serve.Check = &Check{Client: &instrumentedClient{MackerelClient: client, metrics: m}, Concurrency: 1, Logger: l}
+
+	rules := []config.MetricCheckRule{{Name: "web", Service: "blog", InterruptedInterval: "24h"}}
+	_, err := serve.runRules(context.Background(), "web", rules, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.hosts.WithLabelValues("web", hostStatusOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.hosts.WithLabelValues("web", hostStatusInterrupted)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.hosts.WithLabelValues("web", hostStatusSkipped)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.hosts.WithLabelValues("web", hostStatusUnknown)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.apiCalls.WithLabelValues("FindHosts")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.apiCalls.WithLabelValues("PostCheckReports")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.lastRunError.WithLabelValues("web")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.runDuration))
+
+	// The age of the newest data point, which is looked up for the disrupted host as well.
+	assert.InDelta(t, (5 * time.Minute).Seconds(), testutil.ToFloat64(m.lastSeenAge.WithLabelValues("web", "alive")), 60)
+	assert.InDelta(t, (48 * time.Hour).Seconds(), testutil.ToFloat64(m.lastSeenAge.WithLabelValues("web", "dead")), 60)
+
+	t.Run("failures are counted", func(t *testing.T) {
+		server.FailWith("/api/v0/hosts", http.StatusInternalServerError)
+		defer server.FailWith("/api/v0/hosts", 0)
+
+		_, err := serve.runRules(context.Background(), "web", rules, nil)
+		assert.Error(t, err)
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.apiErrors.WithLabelValues("FindHosts")))
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.lastRunError.WithLabelValues("web")))
+	})
+
+	t.Run("metric not found is not counted as a failure", func(t *testing.T) {
+		missing := []config.MetricCheckRule{{
+			Name: "missing", Service: "blog", InterruptedInterval: "24h",
+			InspectionMetrics: map[string][]string{"ec2": {"custom.missing"}},
+		}}
+		_, err := serve.runRules(context.Background(), "missing", missing, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.hosts.WithLabelValues("missing", hostStatusInterrupted)))
+		assert.Less(t, 0.0, testutil.ToFloat64(m.apiCalls.WithLabelValues("FetchHostMetricValues")))
+		assert.Equal(t, 0.0, testutil.ToFloat64(m.apiErrors.WithLabelValues("FetchHostMetricValues")))
+	})
+
+	t.Run("removed rules are forgotten", func(t *testing.T) {
+		before := &config.CheckConfig{Rules: append(slices.Clone(rules), config.MetricCheckRule{Name: "missing"})}
+		after := &config.CheckConfig{Rules: rules}
+		serve.forgetRemovedRules(before, after)
+		assert.Contains(t, serve.runs, "web")
+		assert.NotContains(t, serve.runs, "missing")
+		assert.Equal(t, 4, testutil.CollectAndCount(m.hosts))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.lastRunError))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.runDuration))
+
+		// A run finishing after the rule has been removed is not recorded.
+		serve.config.Store(after)
+		defer serve.config.Store(nil)
+		_, _ = serve.runRules(context.Background(), "missing", before.Rules[1:], nil)
+		assert.NotContains(t, serve.runs, "missing")
+		assert.Equal(t, 1, testutil.CollectAndCount(m.lastRunError))
+	})
+
+	t.Run("exposed in the control API", func(t *testing.T) {
+		api := httptest.NewServer(serve.Handler())
+		defer api.Close()
+		res, err := http.Get(api.URL + "/metrics")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		assert.Contains(t, string(body), `ikesu_rule_hosts{rule="web",status="interrupted"} 1`)
+		assert.Contains(t, string(body), `ikesu_mackerel_api_calls_total{api="FindHosts"}`)
+		assert.Contains(t, string(body), `ikesu_rule_run_duration_seconds_count{rule="web"} 2`)
+	})
+}
@@ -0,0 +1,126 @@
+package subcommand
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+	outputCSV   = "csv"
+)
+
+var outputFormats = []string{outputJSON, outputTable, outputCSV}
+
+// statusSkipped is displayed as the status of the hosts that were not inspected.
+const statusSkipped = "SKIPPED"
+
+// resultRow is a row of the results displayed in dry-run mode.
+type resultRow struct {
+	Rule     string      `json:"rule"`
+	HostID   string      `json:"hostId"`
+	HostName string      `json:"hostName"`
+	Provider string      `json:"provider"`
+	Metrics  []metricRow `json:"metrics"`
+	Points   int         `json:"points"`
+	LastSeen string      `json:"lastSeen"`
+	Status   string      `json:"status"`
+	Message  string      `json:"message,omitempty"`
+}
+
+// metricRow is an inspected metric in a row. LastSeen is empty if no data point was found.
+type metricRow struct {
+	Name     string `json:"name"`
+	LastSeen string `json:"lastSeen"`
+}
+
+func (m metricRow) String() string {
+	if m.LastSeen == "" {
+		return m.Name
+	}
+	return m.Name + "@" + m.LastSeen
+}
+
+var resultColumns = []string{"RULE", "HOST ID", "HOST NAME", "PROVIDER", "METRICS", "POINTS", "LAST SEEN", "STATUS"}
+
+func newResultRow(r *checkResult) *resultRow {
+	row := &resultRow{
+		Rule:     r.Rule,
+		HostID:   r.HostID,
+		HostName: r.HostName,
+		Provider: r.Provider,
+		Metrics:  make([]metricRow, 0, len(r.Metrics)),
+		Points:   r.Points,
+		LastSeen: formatTime(r.newestSeen()),
+		Status:   string(r.Status),
+	}
+	for _, name := range r.Metrics {
+		row.Metrics = append(row.Metrics, metricRow{Name: name, LastSeen: formatTime(r.LastSeen[name])})
+	}
+	if r.Skipped {
+		row.Status = statusSkipped
+	}
+	if r.Report != nil {
+		row.Message = r.Report.Message
+	}
+	return row
+}
+
+// columns returns the values of the row for table and csv, in which each metric is displayed as name@lastSeen.
+func (r *resultRow) columns() []string {
+	metrics := make([]string, 0, len(r.Metrics))
+	for _, m := range r.Metrics {
+		metrics = append(metrics, m.String())
+	}
+	return []string{r.Rule, r.HostID, r.HostName, r.Provider, strings.Join(metrics, ","), strconv.Itoa(r.Points), r.LastSeen, r.Status}
+}
+
+// formatTime returns the unix time in RFC 3339, or an empty string if it is 0.
+func formatTime(unix int64) string {
+	if unix <= 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).Format(time.RFC3339)
+}
+
+// writeResults writes the results to w in the format, which is one of outputFormats.
+func writeResults(w io.Writer, format string, results []*checkResult) error {
+	rows := make([]*resultRow, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, newResultRow(r))
+	}
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(resultColumns); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := cw.Write(row.columns()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case outputTable, "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(resultColumns, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row.columns(), "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unsupported output format, %s has been set", format)
+}
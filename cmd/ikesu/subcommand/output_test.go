@@ -0,0 +1,77 @@
+package subcommand
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteResults(t *testing.T) {
+	lastSeen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	results := []*checkResult{
+		{
+			Rule: "web", HostID: "abc", HostName: "web01", Provider: "ec2",
+			Metrics: []string{"custom.ec2.status_check_failed.instance", "custom.nginx.requests"},
+			Points:  42, LastSeen: map[string]int64{"custom.ec2.status_check_failed.instance": lastSeen.Unix()}, Status: mackerel.CheckStatusOK,
+			Report: &mackerel.CheckReport{Message: "No disruptions were detected in the metrics."},
+		},
+		{Rule: "web", HostID: "def", HostName: "web02", Provider: "azure", Skipped: true},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, writeResults(&buf, outputJSON, results))
+		var rows []resultRow
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &rows))
+		assert.Len(t, rows, 2)
+		assert.Equal(t, "abc", rows[0].HostID)
+		assert.Equal(t, 42, rows[0].Points)
+		assert.Equal(t, lastSeen, mustParseTime(t, rows[0].LastSeen))
+		assert.Equal(t, "OK", rows[0].Status)
+		assert.Equal(t, "No disruptions were detected in the metrics.", rows[0].Message)
+		assert.Equal(t, "custom.ec2.status_check_failed.instance", rows[0].Metrics[0].Name)
+		assert.Equal(t, lastSeen, mustParseTime(t, rows[0].Metrics[0].LastSeen))
+		assert.Equal(t, metricRow{Name: "custom.nginx.requests"}, rows[0].Metrics[1])
+		assert.Equal(t, []metricRow{}, rows[1].Metrics)
+		assert.Equal(t, "", rows[1].LastSeen)
+		assert.Equal(t, statusSkipped, rows[1].Status)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, writeResults(&buf, outputCSV, results))
+		records, err := csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, 3)
+		assert.Equal(t, resultColumns, records[0])
+		assert.Equal(t, "custom.ec2.status_check_failed.instance@"+records[1][6]+",custom.nginx.requests", records[1][4])
+		assert.Equal(t, "42", records[1][5])
+		assert.Equal(t, statusSkipped, records[2][7])
+	})
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, writeResults(&buf, outputTable, results))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "RULE"))
+		assert.Equal(t, []string{"web", "def", "web02", "azure", "0", "SKIPPED"}, strings.Fields(lines[2]))
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		assert.Error(t, writeResults(&bytes.Buffer{}, "yaml", results))
+	})
+}
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, s)
+	assert.NoError(t, err)
+	return parsed.UTC()
+}
@@ -0,0 +1,402 @@
+package subcommand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/robfig/cron/v3"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/config/loader"
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+// NewServeCommand returns a command that keeps running and evaluates each rule on its own schedule.
+func NewServeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "serve",
+		Usage:     "Runs as a daemon and evaluates each rule on its own schedule.",
+		UsageText: "ikesu serve -config <config file> [-config <config file>...] [-default-schedule <interval or cron expression>]",
+		Action: func(ctx *cli.Context) error {
+			check, err := newCheck(ctx)
+			if err != nil {
+				return err
+			}
+			defaultSchedule := config.Schedule(ctx.String("default-schedule"))
+			if _, err := defaultSchedule.Parse(); err != nil {
+				return fmt.Errorf("Invalid default schedule: %w", err)
+			}
+			serve := &Serve{
+				Check:           check,
+				DefaultSchedule: defaultSchedule,
+			}
+			if ctx.Bool("watch") {
+				serve.ConfigPaths = ctx.StringSlice("config")
+			}
+			serve.Addr = ctx.String("addr")
+			serve.ControlToken = ctx.String("control-token")
+
+			check.Log.Info("Run command", "version", ctx.App.Version)
+			check.logConfig()
+			return serve.Run(ctx.Context)
+		},
+		Flags: append(checkFlags(),
+			&cli.StringFlag{
+				Name:    "default-schedule",
+				Usage:   "Specify the schedule of the rules without a schedule, either an interval or a cron expression.",
+				EnvVars: []string{"IKESU_DEFAULT_SCHEDULE"},
+				Value:   "10m",
+			},
+			&cli.BoolFlag{
+				Name:    "watch",
+				Usage:   "Reload the configuration when it changes. The previous configuration is kept if the new one is invalid.",
+				EnvVars: []string{"IKESU_WATCH_CONFIG"},
+				Value:   true,
+			},
+			&cli.StringFlag{
+				Name:    "addr",
+				Usage:   "Specify the address to serve the control API. If empty, it is not served.",
+				EnvVars: []string{"IKESU_ADDR"},
+				Value:   "127.0.0.1:8090",
+			},
+			&cli.StringFlag{
+				Name:    "control-token",
+				Usage:   "Specify the bearer token required to run a rule with the control API. If empty, it is not required.",
+				EnvVars: []string{"IKESU_CONTROL_TOKEN"},
+			},
+		),
+	}
+}
+
+// Serve evaluates each rule of the configuration on its own schedule until the context is canceled.
+type Serve struct {
+	Check *Check
+	// DefaultSchedule is used for the rules without a schedule.
+	DefaultSchedule config.Schedule
+	// ConfigPaths is where the configuration is reloaded from when it changes. If empty, it is not reloaded.
+	ConfigPaths []string
+	// Addr is the address to serve the control API, see Handler. If empty, it is not served.
+	Addr string
+	// ControlToken is the bearer token required by POST /run. If empty, it is not required.
+	ControlToken string
+
+	config atomic.Pointer[config.CheckConfig]
+
+	mu sync.Mutex
+	// running is the names of the rules being evaluated.
+	running map[string]bool
+	// runs is the last evaluation of each rule.
+	runs map[string]*ruleRun
+
+	metricsOnce sync.Once
+	metrics     *serveMetrics
+}
+
+// Run schedules the rules and blocks until the context is canceled.
+// When canceled, it stops scheduling and waits for the running evaluations to complete before returning.
+func (s *Serve) Run(ctx context.Context) error {
+	// The running evaluations are not interrupted by the cancellation, so that the results are reported.
+	jobCtx := context.WithoutCancel(ctx)
+	s.Check.Client = &instrumentedClient{MackerelClient: s.Check.Client, metrics: s.getMetrics()}
+
+	scheduler, err := s.newScheduler(jobCtx, s.Check.Config)
+	if err != nil {
+		return err
+	}
+	s.config.Store(s.Check.Config)
+	scheduler.Start()
+	s.Check.Log.Info("Started to evaluate the rules on their schedules.", "rules", len(scheduler.Entries()))
+
+	var srv *http.Server
+	if s.Addr != "" {
+		srv = &http.Server{Addr: s.Addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			s.Check.Log.Info("Serving the control API.", "addr", s.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.Check.Log.Error("Failed to serve the control API.", "addr", s.Addr, "reason", err.Error())
+			}
+		}()
+	}
+
+	changes := s.watch(ctx)
+	// The schedulers replaced by reloading may still be running evaluations.
+	var stopping []context.Context
+	for {
+		select {
+		case <-ctx.Done():
+			s.Check.Log.Info("Stopping, waiting for the running evaluations to complete.")
+			if srv != nil {
+				if err := srv.Shutdown(jobCtx); err != nil {
+					s.Check.Log.Warn("Failed to shut down the control API.", "reason", err.Error())
+				}
+			}
+			stopping = append(stopping, scheduler.Stop())
+			for _, stopped := range stopping {
+				<-stopped.Done()
+			}
+			s.Check.Log.Info("Stopped.")
+			return nil
+		case _, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			next, err := s.reload(ctx, jobCtx)
+			if err != nil {
+				s.Check.Log.Error("Failed to reload the configuration. The current configuration is kept.", "config", s.ConfigPaths, "reason", err.Error())
+				continue
+			}
+			stopping = append(dropStopped(stopping), scheduler.Stop())
+			scheduler = next
+			scheduler.Start()
+			s.Check.Log.Info("Reloaded the configuration.", "config", s.ConfigPaths, "rules", len(scheduler.Entries()))
+		}
+	}
+}
+
+// dropStopped returns the contexts of the schedulers which are still running evaluations, so that the schedulers
+// replaced by frequent reloading are not kept forever.
+func dropStopped(stopping []context.Context) []context.Context {
+	return slices.DeleteFunc(stopping, func(stopped context.Context) bool {
+		return stopped.Err() != nil
+	})
+}
+
+// Config returns the configuration currently in effect.
+func (s *Serve) Config() *config.CheckConfig {
+	return s.config.Load()
+}
+
+// watch returns a channel notified when any of the configuration files changes, or nil if it is not reloaded.
+func (s *Serve) watch(ctx context.Context) <-chan struct{} {
+	var watching []<-chan struct{}
+	for _, path := range s.ConfigPaths {
+		if changes := s.watchPath(ctx, path); changes != nil {
+			watching = append(watching, changes)
+		}
+	}
+	if len(watching) == 0 {
+		return nil
+	}
+
+	ch := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	for _, changes := range watching {
+		wg.Add(1)
+		go func(changes <-chan struct{}) {
+			defer wg.Done()
+			for range changes {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}(changes)
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+func (s *Serve) watchPath(ctx context.Context, path string) <-chan struct{} {
+	u, err := url.Parse(path)
+	if err != nil {
+		s.Check.Log.Warn("The configuration is not reloaded.", "config", path, "reason", err.Error())
+		return nil
+	}
+	changes, err := loader.WatchWithContext(ctx, u)
+	if errors.Is(err, loader.ErrNotWatchable) {
+		s.Check.Log.Info("The configuration is not reloaded, since the loader does not support watching.", "config", path)
+		return nil
+	} else if err != nil {
+		s.Check.Log.Warn("The configuration is not reloaded.", "config", path, "reason", err.Error())
+		return nil
+	}
+	s.Check.Log.Info("Watching the configuration for changes.", "config", path)
+	return changes
+}
+
+// reload loads and validates the configuration, and returns a scheduler for it which is not started yet.
+func (s *Serve) reload(ctx, jobCtx context.Context) (*cron.Cron, error) {
+	conf, err := config.NewCheckConfig(ctx, s.ConfigPaths...)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	scheduler, err := s.newScheduler(jobCtx, conf)
+	if err != nil {
+		return nil, err
+	}
+	prev := s.config.Swap(conf)
+	s.forgetRemovedRules(prev, conf)
+	return scheduler, nil
+}
+
+// forgetRemovedRules deletes the last runs and the metrics of the rules which are no longer in the configuration.
+func (s *Serve) forgetRemovedRules(prev, conf *config.CheckConfig) {
+	if prev == nil {
+		return
+	}
+	names := ruleNamesOf(conf)
+	for _, name := range ruleNamesOf(prev) {
+		if slices.Contains(names, name) {
+			continue
+		}
+		s.mu.Lock()
+		delete(s.runs, name)
+		s.mu.Unlock()
+		s.getMetrics().forget(name)
+	}
+}
+
+func ruleNamesOf(conf *config.CheckConfig) []string {
+	var names []string
+	for _, rule := range conf.Rules {
+		names = append(names, rule.Name)
+	}
+	for _, rule := range conf.ServiceRules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
+
+// newScheduler returns a scheduler which evaluates each rule of the configuration.
+func (s *Serve) newScheduler(ctx context.Context, conf *config.CheckConfig) (*cron.Cron, error) {
+	scheduler := cron.New(cron.WithLogger(cronLogger{s.Check.Logger}))
+	for _, rule := range conf.Rules {
+		rule := rule
+		err := s.schedule(scheduler, rule.Name, rule.Schedule, func() {
+			_, _ = s.runRules(ctx, rule.Name, []config.MetricCheckRule{rule}, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range conf.ServiceRules {
+		rule := rule
+		err := s.schedule(scheduler, rule.Name, rule.Schedule, func() {
+			_, _ = s.runRules(ctx, rule.Name, nil, []config.ServiceMetricCheckRule{rule})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return scheduler, nil
+}
+
+// schedule adds the evaluation of a rule to the scheduler.
+func (s *Serve) schedule(scheduler *cron.Cron, name string, schedule config.Schedule, run func()) error {
+	if schedule == "" {
+		schedule = s.DefaultSchedule
+	}
+	sched, err := schedule.Parse()
+	if err != nil {
+		return fmt.Errorf("Invalid schedule for check '%s': %w", name, err)
+	}
+	scheduler.Schedule(sched, cron.FuncJob(run))
+	s.Check.Log.Info("Scheduled the rule.", "rule", name, "schedule", schedule)
+	return nil
+}
+
+var errAlreadyRunning = errors.New("The rule is already being evaluated.")
+
+// ruleRun is the last evaluation of a rule. Reports is what has been reported, or would have been in dry-run mode.
+type ruleRun struct {
+	Rule       string                  `json:"rule"`
+	StartedAt  time.Time               `json:"startedAt"`
+	FinishedAt time.Time               `json:"finishedAt"`
+	Reports    []*mackerel.CheckReport `json:"reports"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+// runRules evaluates the rules with the name, and records the run.
+// The evaluation is skipped with errAlreadyRunning while the previous one of the same name is still running,
+// whether it was started on schedule or on demand.
+func (s *Serve) runRules(ctx context.Context, name string, rules []config.MetricCheckRule, serviceRules []config.ServiceMetricCheckRule) (*ruleRun, error) {
+	if !s.begin(name) {
+		s.Check.Log.Warn("Skipping the evaluation because the previous one is still running.", "rule", name)
+		return nil, errAlreadyRunning
+	}
+	defer s.end(name)
+
+	s.Check.Log.Info("Evaluating the rule.", "rule", name)
+	run := &ruleRun{Rule: name, StartedAt: time.Now(), Reports: make([]*mackerel.CheckReport, 0)}
+	results, err := s.Check.runRules(ctx, rules, serviceRules)
+	run.FinishedAt = time.Now()
+	for _, result := range results {
+		if result.Report != nil {
+			run.Reports = append(run.Reports, result.Report)
+		}
+	}
+	if err != nil {
+		s.Check.Log.Error("Failed to evaluate the rule.", "rule", name, "reason", err.Error())
+		run.Error = err.Error()
+	}
+
+	// The rule removed by reloading during the evaluation is not recorded, so that it does not reappear in the results and the metrics.
+	if conf := s.Config(); conf != nil && !slices.Contains(ruleNamesOf(conf), name) {
+		return run, err
+	}
+	s.getMetrics().observe(run, results)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.runs == nil {
+		s.runs = make(map[string]*ruleRun)
+	}
+	s.runs[name] = run
+	return run, err
+}
+
+// getMetrics returns the metrics exposed for Prometheus, see serveMetrics.
+func (s *Serve) getMetrics() *serveMetrics {
+	s.metricsOnce.Do(func() {
+		s.metrics = newServeMetrics()
+	})
+	return s.metrics
+}
+
+func (s *Serve) begin(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[name] {
+		return false
+	}
+	if s.running == nil {
+		s.running = make(map[string]bool)
+	}
+	s.running[name] = true
+	return true
+}
+
+func (s *Serve) end(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, name)
+}
+
+// cronLogger adapts the logger to cron.Logger. The scheduler's routine messages are logged at the debug level.
+type cronLogger struct {
+	*logger.Logger
+}
+
+func (l cronLogger) Info(msg string, keysAndValues ...any) {
+	l.Log.Debug(msg, keysAndValues...)
+}
+
+func (l cronLogger) Error(err error, msg string, keysAndValues ...any) {
+	l.Log.Error(msg, append(keysAndValues, "reason", err.Error())...)
+}
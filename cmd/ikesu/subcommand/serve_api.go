@@ -0,0 +1,122 @@
+package subcommand
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tukaelu/ikesu/internal/config"
+)
+
+// Handler returns the control API of the serve mode.
+//
+//	GET  /healthz          returns 200 while the process is alive.
+//	POST /run?rule=<name>  evaluates the rule immediately and returns the run. It requires ControlToken as the bearer token if set.
+//	GET  /results          returns the last run of each rule.
+//	GET  /metrics          returns the metrics for Prometheus, see serveMetrics.
+func (s *Serve) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/run", s.handleRun)
+	mux.HandleFunc("/results", s.handleResults)
+	mux.Handle("/metrics", s.getMetrics().handler())
+	return mux
+}
+
+func (s *Serve) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Serve) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "Only POST is allowed.")
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ikesu"`)
+		writeError(w, http.StatusUnauthorized, "The control token is missing or invalid.")
+		return
+	}
+	name := r.URL.Query().Get("rule")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "The rule is not specified.")
+		return
+	}
+	rules, serviceRules := findRules(s.Config(), name)
+	if len(rules) == 0 && len(serviceRules) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No such rule '%s'.", name))
+		return
+	}
+
+	// The evaluation is not interrupted even if the caller disconnects, since the run is recorded and reported as well as the scheduled ones.
+	run, err := s.runRules(context.WithoutCancel(r.Context()), name, rules, serviceRules)
+	switch {
+	case errors.Is(err, errAlreadyRunning):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, run)
+	default:
+		writeJSON(w, http.StatusOK, run)
+	}
+}
+
+// authorized returns whether the request has the control token, which is compared in constant time.
+func (s *Serve) authorized(r *http.Request) bool {
+	if s.ControlToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.ControlToken)) == 1
+}
+
+func (s *Serve) handleResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "Only GET is allowed.")
+		return
+	}
+	s.mu.Lock()
+	runs := make([]*ruleRun, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+	slices.SortFunc(runs, func(a, b *ruleRun) int {
+		return strings.Compare(a.Rule, b.Rule)
+	})
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// findRules returns the host rules and the service rules with the name.
+func findRules(conf *config.CheckConfig, name string) ([]config.MetricCheckRule, []config.ServiceMetricCheckRule) {
+	var rules []config.MetricCheckRule
+	var serviceRules []config.ServiceMetricCheckRule
+	for _, rule := range conf.Rules {
+		if rule.Name == name {
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range conf.ServiceRules {
+		if rule.Name == name {
+			serviceRules = append(serviceRules, rule)
+		}
+	}
+	return rules, serviceRules
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
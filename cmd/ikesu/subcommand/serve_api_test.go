@@ -0,0 +1,159 @@
+package subcommand
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/fakemackerel"
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+func TestServeHandler(t *testing.T) {
+	server := fakemackerel.NewServer()
+	fixture := &fakemackerel.Fixture{
+		Services: []fakemackerel.FixtureService{{Name: "blog", Roles: []string{"web"}}},
+		Hosts: []fakemackerel.FixtureHost{
+			{ID: "dead", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "48h"},
+			}},
+		},
+		ServiceMetrics: map[string]map[string]fakemackerel.Series{
+			"blog": {"kpi.orders": {LastPosted: "1h"}},
+		},
+	}
+	assert.NoError(t, server.Load(fixture, time.Now()))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+	l, _ := logger.NewLogger("", "error", false)
+	serve := &Serve{Check: &Check{Client: client, Concurrency: 1, Logger: l}}
+	serve.config.Store(&config.CheckConfig{
+		Rules: []config.MetricCheckRule{
+			{Name: "web", Service: "blog", InterruptedInterval: "24h"},
+		},
+		ServiceRules: []config.ServiceMetricCheckRule{
+			{Name: "kpi", Service: "blog", InterruptedInterval: "6h", InspectionMetrics: []string{"kpi.orders"}, ReportHostID: "dead"},
+		},
+	})
+	api := httptest.NewServer(serve.Handler())
+	defer api.Close()
+
+	t.Run("healthz", func(t *testing.T) {
+		res, err := http.Get(api.URL + "/healthz")
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("run a rule on demand", func(t *testing.T) {
+		res, err := http.Post(api.URL+"/run?rule=web", "", nil)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var run struct {
+			Rule    string                `json:"rule"`
+			Reports []fakemackerel.Report `json:"reports"`
+		}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&run))
+		assert.Equal(t, "web", run.Rule)
+		assert.Len(t, run.Reports, 1)
+		assert.Equal(t, "CRITICAL", run.Reports[0].Status)
+		assert.Equal(t, "dead", run.Reports[0].Source.HostID)
+		assert.Len(t, server.Reports(), 1)
+	})
+
+	t.Run("results of the last runs", func(t *testing.T) {
+		res, err := http.Post(api.URL+"/run?rule=kpi", "", nil)
+		assert.NoError(t, err)
+		res.Body.Close()
+
+		res, err = http.Get(api.URL + "/results")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		var runs []struct {
+			Rule    string                `json:"rule"`
+			Reports []fakemackerel.Report `json:"reports"`
+		}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&runs))
+		assert.Len(t, runs, 2)
+		assert.Equal(t, "kpi", runs[0].Rule)
+		assert.Equal(t, "OK", runs[0].Reports[0].Status)
+		assert.Equal(t, "web", runs[1].Rule)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			method string
+			path   string
+			code   int
+		}{
+			{http.MethodGet, "/run?rule=web", http.StatusMethodNotAllowed},
+			{http.MethodPost, "/run", http.StatusBadRequest},
+			{http.MethodPost, "/run?rule=unknown", http.StatusNotFound},
+			{http.MethodPost, "/results", http.StatusMethodNotAllowed},
+		}
+		for _, c := range cases {
+			req, _ := http.NewRequest(c.method, api.URL+c.path, nil)
+			res, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, c.code, res.StatusCode, c.method+" "+c.path)
+		}
+	})
+
+	t.Run("a run is not interrupted by the caller", func(t *testing.T) {
+		serve.Check.Limiter = rate.NewLimiter(rate.Limit(100), 1)
+		defer func() { serve.Check.Limiter = nil }()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest(http.MethodPost, "/run?rule=web", nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		serve.handleRun(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, mackerel.CheckStatusCritical, serve.runs["web"].Reports[0].Status)
+		assert.Empty(t, serve.runs["web"].Error)
+	})
+
+	t.Run("a rule being evaluated is not run again", func(t *testing.T) {
+		assert.True(t, serve.begin("web"))
+		defer serve.end("web")
+		res, err := http.Post(api.URL+"/run?rule=web", "", nil)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+	})
+	t.Run("control token", func(t *testing.T) {
+		serve.ControlToken = "secret"
+		defer func() { serve.ControlToken = "" }()
+		do := func(method, path, authorization string) int {
+			req, _ := http.NewRequest(method, api.URL+path, nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			res, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			res.Body.Close()
+			return res.StatusCode
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/run?rule=web", ""))
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/run?rule=web", "Bearer wrong"))
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/run?rule=web", "secret"))
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/run?rule=web", "Bearer secret"))
+		// The read-only endpoints do not require the token.
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/healthz", ""))
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/results", ""))
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/metrics", ""))
+	})
+}
@@ -0,0 +1,167 @@
+package subcommand
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	_ "github.com/tukaelu/ikesu/internal/config/loader/file"
+	"github.com/tukaelu/ikesu/internal/fakemackerel"
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+func TestServeRun(t *testing.T) {
+	server := fakemackerel.NewServer()
+	fixture := &fakemackerel.Fixture{
+		Services: []fakemackerel.FixtureService{{Name: "blog", Roles: []string{"web"}}},
+		Hosts: []fakemackerel.FixtureHost{
+			{ID: "alive", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "5m"},
+			}},
+		},
+	}
+	assert.NoError(t, server.Load(fixture, time.Now()))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+	l, _ := logger.NewLogger("", "error", false)
+	serve := &Serve{
+		Check: &Check{
+			Config: &config.CheckConfig{Rules: []config.MetricCheckRule{
+				{Name: "every-second", Service: "blog", InterruptedInterval: "24h", Schedule: "1s"},
+				{Name: "default", Service: "blog", InterruptedInterval: "24h"},
+			}},
+			Client:      client,
+			Concurrency: 1,
+			Logger:      l,
+		},
+		DefaultSchedule: "@daily",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, serve.Run(ctx))
+
+	counts := make(map[string]int)
+	for _, r := range server.Reports() {
+		counts[r.Name]++
+	}
+	assert.GreaterOrEqual(t, counts["Ikesu Check(rule=every-second)"], 1)
+	assert.Zero(t, counts["Ikesu Check(rule=default)"])
+}
+
+func TestServeRunWithInvalidSchedule(t *testing.T) {
+	l, _ := logger.NewLogger("", "error", false)
+	serve := &Serve{
+		Check: &Check{
+			Config: &config.CheckConfig{ServiceRules: []config.ServiceMetricCheckRule{
+				{Name: "kpi", Service: "blog", Schedule: "every day"},
+			}},
+			Logger: l,
+		},
+		DefaultSchedule: "10m",
+	}
+	assert.ErrorContains(t, serve.Run(context.Background()), "Invalid schedule for check 'kpi'")
+}
+
+func TestServeReload(t *testing.T) {
+	server := fakemackerel.NewServer()
+	fixture := &fakemackerel.Fixture{
+		Services: []fakemackerel.FixtureService{{Name: "blog", Roles: []string{"web"}}},
+		Hosts: []fakemackerel.FixtureHost{
+			{ID: "alive", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.ec2.status_check_failed.instance": {LastPosted: "5m"},
+			}},
+		},
+	}
+	assert.NoError(t, server.Load(fixture, time.Now()))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "check.yml")
+	writeConfig := func(content string) {
+		t.Helper()
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	writeConfig("check:\n  - name: before\n    service: blog\n    schedule: \"@daily\"\n")
+	conf, err := config.NewCheckConfig(context.Background(), path)
+	assert.NoError(t, err)
+
+	client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+	// The logs tell when the configuration is watched and when a reload has failed.
+	logs := &lockedBuffer{}
+	l := &logger.Logger{Log: *slog.New(slog.NewJSONHandler(logs, nil))}
+	serve := &Serve{
+		Check:           &Check{Config: conf, Client: client, Concurrency: 1, Logger: l},
+		DefaultSchedule: "@daily",
+		ConfigPaths:     []string{path},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- serve.Run(ctx)
+	}()
+
+	reported := func(name string) bool {
+		for _, r := range server.Reports() {
+			if r.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	assert.Eventually(t, func() bool { return logs.contains("Watching the configuration for changes.") }, 5*time.Second, 10*time.Millisecond)
+	writeConfig("check:\n  - name: after\n    service: blog\n    schedule: 1s\n")
+	assert.Eventually(t, func() bool { return reported("Ikesu Check(rule=after)") }, 5*time.Second, 100*time.Millisecond)
+	assert.Equal(t, "after", serve.Config().Rules[0].Name)
+
+	// An invalid configuration is not applied, and the previous one keeps running.
+	writeConfig("check:\n  - name: broken\n")
+	assert.Eventually(t, func() bool { return logs.contains("Failed to reload the configuration.") }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "after", serve.Config().Rules[0].Name)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.False(t, reported("Ikesu Check(rule=before)"))
+}
+
+// lockedBuffer is a buffer which the logs can be written to and read from concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) contains(s string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Contains(b.buf.String(), s)
+}
+
+func TestDropStopped(t *testing.T) {
+	stopped, stop := context.WithCancel(context.Background())
+	stop()
+	running, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.Equal(t, []context.Context{running}, dropStopped([]context.Context{stopped, running, stopped}))
+	assert.Empty(t, dropStopped([]context.Context{stopped}))
+}
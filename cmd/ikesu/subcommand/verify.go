@@ -0,0 +1,227 @@
+package subcommand
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/mackerelio/mackerel-client-go"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/metricname"
+)
+
+// finding is a problem of a rule found by verifying it against the organization.
+type finding struct {
+	Rule    string
+	Message string
+}
+
+func (f finding) String() string {
+	return fmt.Sprintf("check '%s': %s", f.Rule, f.Message)
+}
+
+// verifier verifies the rules against the organization, in which the responses of the API are shared by the rules.
+type verifier struct {
+	*Check
+
+	services map[string]bool
+
+	mu          sync.Mutex
+	roles       map[string][]string
+	metricNames map[string][]string
+}
+
+// verify returns the problems of the rules that are silently ignored by check, such as a misspelled service.
+// An error is returned only if the API fails.
+func (c *Check) verify(ctx context.Context) ([]finding, error) {
+	v := &verifier{Check: c, roles: make(map[string][]string), metricNames: make(map[string][]string)}
+
+	var services []*mackerel.Service
+	err := c.callAPI(ctx, func() (err error) {
+		services, err = c.Client.FindServices()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	v.services = make(map[string]bool, len(services))
+	for _, svc := range services {
+		v.services[svc.Name] = true
+	}
+
+	var findings []finding
+	for _, rule := range c.Config.Rules {
+		f, err := v.verifyHostRule(ctx, rule)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f...)
+	}
+	for _, rule := range c.Config.ServiceRules {
+		f, err := v.verifyServiceRule(ctx, rule)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f...)
+	}
+	return findings, nil
+}
+
+func (v *verifier) verifyHostRule(ctx context.Context, rule config.MetricCheckRule) ([]finding, error) {
+	report := func(format string, args ...any) []finding {
+		return []finding{{Rule: rule.Name, Message: fmt.Sprintf(format, args...)}}
+	}
+	if !v.services[rule.Service] {
+		return report("The service '%s' does not exist.", rule.Service), nil
+	}
+
+	var findings []finding
+	roles, err := v.findRoles(ctx, rule.Service)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range rule.Roles {
+		if !slices.Contains(roles, role) {
+			findings = append(findings, report("The role '%s' does not exist in the service '%s'.", role, rule.Service)...)
+		}
+	}
+	if len(findings) > 0 {
+		return findings, nil
+	}
+
+	var hosts []*mackerel.Host
+	err = v.callAPI(ctx, func() (err error) {
+		hosts, err = v.Client.FindHosts(&mackerel.FindHostsParam{Service: rule.Service, Roles: rule.Roles})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return report("No hosts match the service '%s' and the roles %v.", rule.Service, rule.Roles), nil
+	}
+
+	hostsByProvider := make(map[string][]*mackerel.Host)
+	for _, host := range hosts {
+		provider := getHostProviderType(host)
+		if len(rule.Providers) > 0 && !slices.Contains(rule.Providers, config.Provider(provider)) {
+			continue
+		}
+		hostsByProvider[provider] = append(hostsByProvider[provider], host)
+	}
+	if len(hostsByProvider) == 0 {
+		return report("None of the %d hosts matching the rule is of the providers %v.", len(hosts), rule.Providers), nil
+	}
+
+	providers := make([]string, 0, len(rule.InspectionMetrics))
+	for provider := range rule.InspectionMetrics {
+		providers = append(providers, provider)
+	}
+	slices.Sort(providers)
+	for _, provider := range providers {
+		targets := hostsByProvider[provider]
+		if len(targets) == 0 {
+			findings = append(findings, report("No hosts of the provider '%s' match the rule, so its inspection metrics are never inspected.", provider)...)
+			continue
+		}
+		posted, err := v.postedHostMetricNames(ctx, targets)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range rule.InspectionMetrics[provider] {
+			if !isPosted(name, posted) {
+				findings = append(findings, report("The inspection metric '%s' has never been posted by any of the %d hosts of the provider '%s'.", name, len(targets), provider)...)
+			}
+		}
+	}
+	return findings, nil
+}
+
+func (v *verifier) verifyServiceRule(ctx context.Context, rule config.ServiceMetricCheckRule) ([]finding, error) {
+	if !v.services[rule.Service] {
+		return []finding{{Rule: rule.Name, Message: fmt.Sprintf("The service '%s' does not exist.", rule.Service)}}, nil
+	}
+	var posted []string
+	err := v.callAPI(ctx, func() (err error) {
+		posted, err = v.Client.ListServiceMetricNames(rule.Service)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var findings []finding
+	for _, name := range rule.InspectionMetrics {
+		if !isPosted(name, posted) {
+			findings = append(findings, finding{Rule: rule.Name, Message: fmt.Sprintf("The inspection metric '%s' has never been posted to the service '%s'.", name, rule.Service)})
+		}
+	}
+	return findings, nil
+}
+
+// findRoles returns the names of the roles of the service.
+func (v *verifier) findRoles(ctx context.Context, service string) ([]string, error) {
+	if names, ok := v.roles[service]; ok {
+		return names, nil
+	}
+	var roles []*mackerel.Role
+	err := v.callAPI(ctx, func() (err error) {
+		roles, err = v.Client.FindRoles(service)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	v.roles[service] = names
+	return names, nil
+}
+
+// postedHostMetricNames returns the metric names posted by any of the hosts.
+func (v *verifier) postedHostMetricNames(ctx context.Context, hosts []*mackerel.Host) ([]string, error) {
+	type listed struct {
+		names []string
+		err   error
+	}
+	results := parallelMap(v.Concurrency, hosts, func(host *mackerel.Host) listed {
+		v.mu.Lock()
+		names, ok := v.metricNames[host.ID]
+		v.mu.Unlock()
+		if ok {
+			return listed{names: names}
+		}
+		err := v.callAPI(ctx, func() (err error) {
+			names, err = v.Client.ListHostMetricNames(host.ID)
+			return err
+		})
+		if err == nil {
+			v.mu.Lock()
+			v.metricNames[host.ID] = names
+			v.mu.Unlock()
+		}
+		return listed{names: names, err: err}
+	})
+
+	var posted []string
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		posted = append(posted, r.names...)
+	}
+	return posted, nil
+}
+
+// isPosted returns whether the metric name, which may be a pattern, matches any of the posted names.
+func isPosted(name string, posted []string) bool {
+	if !metricname.IsPattern(name) {
+		return slices.Contains(posted, name)
+	}
+	// The patterns have already been validated, so the error can be ignored.
+	matched, _ := metricname.Expand(name, posted)
+	return len(matched) > 0
+}
@@ -0,0 +1,89 @@
+package subcommand
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tukaelu/ikesu/internal/config"
+	"github.com/tukaelu/ikesu/internal/fakemackerel"
+	"github.com/tukaelu/ikesu/internal/logger"
+)
+
+func TestVerify(t *testing.T) {
+	server := fakemackerel.NewServer()
+	fixture := &fakemackerel.Fixture{
+		Services: []fakemackerel.FixtureService{{Name: "blog", Roles: []string{"web", "db", "batch"}}},
+		Hosts: []fakemackerel.FixtureHost{
+			{ID: "web01", Roles: map[string][]string{"blog": {"web"}}, Provider: "ec2", Metrics: map[string]fakemackerel.Series{
+				"custom.nginx.requests": {LastPosted: "5m"},
+			}},
+			{ID: "db01", Roles: map[string][]string{"blog": {"db"}}, Provider: "rds"},
+		},
+		ServiceMetrics: map[string]map[string]fakemackerel.Series{
+			"blog": {"kpi.orders": {LastPosted: "1h"}},
+		},
+	}
+	assert.NoError(t, server.Load(fixture, time.Now()))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	verify := func(t *testing.T, conf *config.CheckConfig) []string {
+		t.Helper()
+		client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+		l, _ := logger.NewLogger("", "error", false)
+		c := &Check{Config: conf, Client: client, Concurrency: 2, Logger: l}
+		findings, err := c.verify(context.TODO())
+		assert.NoError(t, err)
+		var messages []string
+		for _, f := range findings {
+			messages = append(messages, f.String())
+		}
+		return messages
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assert.Empty(t, verify(t, &config.CheckConfig{
+			Rules: []config.MetricCheckRule{
+				{Name: "web", Service: "blog", Roles: []string{"web"}, InspectionMetrics: map[string][]string{"ec2": {"custom.nginx.*"}}},
+			},
+			ServiceRules: []config.ServiceMetricCheckRule{
+				{Name: "kpi", Service: "blog", InspectionMetrics: []string{"kpi.orders"}, ReportHostID: "web01"},
+			},
+		}))
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		messages := verify(t, &config.CheckConfig{
+			Rules: []config.MetricCheckRule{
+				{Name: "typo", Service: "blgo"},
+				{Name: "role", Service: "blog", Roles: []string{"wbe"}},
+				{Name: "empty", Service: "blog", Roles: []string{"batch"}},
+				{Name: "provider", Service: "blog", Providers: []config.Provider{"lambda"}},
+				{Name: "metric", Service: "blog", InspectionMetrics: map[string][]string{
+					"ec2":    {"custom.nginx.requests", "custom.nginx.errors", "/^custom\\.php\\./"},
+					"lambda": {"custom.lambda.count"},
+				}},
+			},
+			ServiceRules: []config.ServiceMetricCheckRule{
+				{Name: "kpi", Service: "blog", InspectionMetrics: []string{"kpi.orders", "kpi.users"}, ReportHostID: "web01"},
+				{Name: "kpi-typo", Service: "blgo", InspectionMetrics: []string{"kpi.orders"}, ReportHostID: "web01"},
+			},
+		})
+		assert.Equal(t, []string{
+			"check 'typo': The service 'blgo' does not exist.",
+			"check 'role': The role 'wbe' does not exist in the service 'blog'.",
+			"check 'empty': No hosts match the service 'blog' and the roles [batch].",
+			"check 'provider': None of the 2 hosts matching the rule is of the providers [lambda].",
+			"check 'metric': The inspection metric 'custom.nginx.errors' has never been posted by any of the 1 hosts of the provider 'ec2'.",
+			"check 'metric': The inspection metric '/^custom\\.php\\./' has never been posted by any of the 1 hosts of the provider 'ec2'.",
+			"check 'metric': No hosts of the provider 'lambda' match the rule, so its inspection metrics are never inspected.",
+			"check 'kpi': The inspection metric 'kpi.users' has never been posted to the service 'blog'.",
+			"check 'kpi-typo': The service 'blgo' does not exist.",
+		}, messages)
+	})
+}
@@ -5,13 +5,38 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"slices"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/robfig/cron/v3"
 
 	"github.com/tukaelu/ikesu/internal/config/loader"
 	"github.com/tukaelu/ikesu/internal/constants"
+	"github.com/tukaelu/ikesu/internal/metricname"
+)
+
+const defaultInterruptedInterval = InterruptedInterval("24h")
+
+const (
+	// StrategyWindow scans the metric values over the whole interval in windows.
+	StrategyWindow = Strategy("window")
+	// StrategyLatest judges from the timestamps of the latest metric values fetched for many hosts at once, and scans the windows only when necessary.
+	StrategyLatest = Strategy("latest")
+)
+
+const (
+	// MatchAny is OK if any of the inspection metrics has been posted.
+	MatchAny = Match("any")
+	// MatchAll is OK only if all of the inspection metrics have been posted.
+	MatchAll = Match("all")
+)
+
+const (
+	// OnAPIErrorUnknown reports UNKNOWN when the posting status could not be determined due to an API failure.
+	OnAPIErrorUnknown = OnAPIError("unknown")
+	// OnAPIErrorSkip does not report anything when the posting status could not be determined due to an API failure.
+	OnAPIErrorSkip = OnAPIError("skip")
 )
 
 var (
@@ -21,58 +46,243 @@ var (
 )
 
 type CheckConfig struct {
-	Rules []MetricCheckRule `yaml:"check"`
+	// Defaults and ProviderDefaults are applied to the rules of the same file by NewCheckConfig, and are empty in the configuration returned.
+	Defaults         RuleDefaults                  `yaml:"defaults,omitempty"`
+	ProviderDefaults map[Provider]ProviderDefaults `yaml:"provider_defaults,omitempty"`
+	Rules            []MetricCheckRule             `yaml:"check,omitempty"`
+	ServiceRules     []ServiceMetricCheckRule      `yaml:"service_check,omitempty"`
+
+	// rulePositions and serviceRulePositions are where the rules are defined, in the same order as Rules and ServiceRules.
+	// They are empty if the configuration is not loaded from the files.
+	rulePositions        []*rulePosition
+	serviceRulePositions []*rulePosition
 }
 
 type MetricCheckRule struct {
-	Name                string              `yaml:"name"`
-	Service             string              `yaml:"service"`
-	Roles               []string            `yaml:"roles"`
-	InterruptedInterval InterruptedInterval `yaml:"interrupted_interval"`
-	Providers           []Provider          `yaml:"providers"`
-	InspectionMetrics   map[string][]string `yaml:"inspection_metrics"`
+	Name                string              `yaml:"name,omitempty"`
+	Service             string              `yaml:"service,omitempty"`
+	Roles               []string            `yaml:"roles,omitempty"`
+	InterruptedInterval InterruptedInterval `yaml:"interrupted_interval,omitempty"`
+	WarningInterval     InterruptedInterval `yaml:"warning_interval,omitempty"`
+	CriticalInterval    InterruptedInterval `yaml:"critical_interval,omitempty"`
+	Providers           []Provider          `yaml:"providers,omitempty"`
+	InspectionMetrics   map[string][]string `yaml:"inspection_metrics,omitempty"`
+	OnAPIError          OnAPIError          `yaml:"on_api_error,omitempty"`
+	Strategy            Strategy            `yaml:"strategy,omitempty"`
+	Match               Match               `yaml:"match,omitempty"`
+	MinPresent          int                 `yaml:"min_present,omitempty"`
+	Schedule            Schedule            `yaml:"schedule,omitempty"`
+}
+
+// ServiceMetricCheckRule is a rule that inspects the service metrics of a service.
+// The check monitoring API only accepts hosts as the source of a report, so the result is reported to the host specified in ReportHostID.
+type ServiceMetricCheckRule struct {
+	Name                string              `yaml:"name,omitempty"`
+	Service             string              `yaml:"service,omitempty"`
+	InterruptedInterval InterruptedInterval `yaml:"interrupted_interval,omitempty"`
+	WarningInterval     InterruptedInterval `yaml:"warning_interval,omitempty"`
+	CriticalInterval    InterruptedInterval `yaml:"critical_interval,omitempty"`
+	InspectionMetrics   []string            `yaml:"inspection_metrics,omitempty"`
+	ReportHostID        string              `yaml:"report_host_id,omitempty"`
+	OnAPIError          OnAPIError          `yaml:"on_api_error,omitempty"`
+	Match               Match               `yaml:"match,omitempty"`
+	MinPresent          int                 `yaml:"min_present,omitempty"`
+	Schedule            Schedule            `yaml:"schedule,omitempty"`
 }
 
 type InterruptedInterval string
 type Provider string
 
+// Match is how many of the inspection metrics must have been posted.
+type Match string
+
+// Strategy is how to retrieve the metric values of the hosts.
+type Strategy string
+
+// OnAPIError is how to handle the case where the posting status could not be determined due to an API failure.
+type OnAPIError string
+
+// Schedule is when a rule is evaluated in the serve mode, either an interval such as "5m" or a cron expression such as "*/5 * * * *".
+type Schedule string
+
 // Validate returns the result of the validation.
 func (c *CheckConfig) Validate() error {
-	if c == nil || len(c.Rules) == 0 {
+	if c == nil || (len(c.Rules) == 0 && len(c.ServiceRules) == 0) {
 		return ErrNoCheckRules
 	}
 
+	// The problems are reported with the positions in the files, since the rules may be merged from several files.
 	var err error
-	for _, rule := range c.Rules {
-		if e := rule.validate(); e != nil {
-			err = errors.Join(err, e)
-		}
+	for i, rule := range c.Rules {
+		err = errors.Join(err, rule.validateAt(positionOf(c.rulePositions, i)))
+	}
+	for i, rule := range c.ServiceRules {
+		err = errors.Join(err, rule.validateAt(positionOf(c.serviceRulePositions, i)))
 	}
 	return err
 }
 
+func positionOf(positions []*rulePosition, i int) *rulePosition {
+	if i < len(positions) {
+		return positions[i]
+	}
+	return nil
+}
+
 func (r *MetricCheckRule) validate() error {
+	return r.validateAt(nil)
+}
+
+// validateAt validates the rule, and adds the position to each problem if it is known.
+func (r *MetricCheckRule) validateAt(p *rulePosition) error {
 	var err error
 	if r.Name == "" {
-		err = errors.Join(err, fmt.Errorf("No name has been specified for the check."))
+		err = errors.Join(err, p.wrap("name", fmt.Errorf("No name has been specified for the check.")))
 	}
 	if r.Service == "" {
-		err = errors.Join(err, fmt.Errorf("Service not specified for check '%s'.", r.Name))
+		err = errors.Join(err, p.wrap("service", fmt.Errorf("Service not specified for check '%s'.", r.Name)))
 	}
-	err = errors.Join(err, r.InterruptedInterval.validate())
+	err = errors.Join(err, validateThresholds(r.Name, r.InterruptedInterval, r.WarningInterval, r.CriticalInterval, p))
+	err = errors.Join(err, p.wrap("on_api_error", r.OnAPIError.validate()))
+	err = errors.Join(err, p.wrap("strategy", r.Strategy.validate()))
+	err = errors.Join(err, validateMatch(r.Name, r.Match, r.MinPresent, p))
+	err = errors.Join(err, p.wrap("schedule", r.Schedule.validate()))
 	for _, provider := range r.Providers {
-		err = errors.Join(err, provider.validate())
+		err = errors.Join(err, p.wrap("providers", provider.validate()))
+	}
+	for _, names := range r.InspectionMetrics {
+		err = errors.Join(err, validateInspectionMetrics(r.Name, names, p))
+	}
+	return err
+}
+
+func (r *ServiceMetricCheckRule) validate() error {
+	return r.validateAt(nil)
+}
+
+// validateAt validates the rule, and adds the position to each problem if it is known.
+func (r *ServiceMetricCheckRule) validateAt(p *rulePosition) error {
+	var err error
+	if r.Name == "" {
+		err = errors.Join(err, p.wrap("name", fmt.Errorf("No name has been specified for the service check.")))
+	}
+	if r.Service == "" {
+		err = errors.Join(err, p.wrap("service", fmt.Errorf("Service not specified for service check '%s'.", r.Name)))
+	}
+	if len(r.InspectionMetrics) == 0 {
+		err = errors.Join(err, p.wrap("inspection_metrics", fmt.Errorf("No inspection metrics specified for service check '%s'.", r.Name)))
+	}
+	if r.ReportHostID == "" {
+		err = errors.Join(err, p.wrap("report_host_id", fmt.Errorf("The host to report to is not specified for service check '%s'.", r.Name)))
+	}
+	err = errors.Join(err, validateThresholds(r.Name, r.InterruptedInterval, r.WarningInterval, r.CriticalInterval, p))
+	err = errors.Join(err, p.wrap("on_api_error", r.OnAPIError.validate()))
+	err = errors.Join(err, validateMatch(r.Name, r.Match, r.MinPresent, p))
+	err = errors.Join(err, p.wrap("schedule", r.Schedule.validate()))
+	err = errors.Join(err, validateInspectionMetrics(r.Name, r.InspectionMetrics, p))
+	return err
+}
+
+// The metric names may be wildcards or regular expressions, see metricname.IsPattern.
+func validateInspectionMetrics(name string, metricNames []string, p *rulePosition) error {
+	var err error
+	for _, metricName := range metricNames {
+		if !metricname.IsPattern(metricName) {
+			continue
+		}
+		if _, e := metricname.Compile(metricName); e != nil {
+			err = errors.Join(err, p.wrap("inspection_metrics", fmt.Errorf("Invalid inspection metric for check '%s': %w", name, e)))
+		}
+	}
+	return err
+}
+
+// Thresholds returns the intervals to be judged as WARNING and CRITICAL.
+// The warning interval is empty if it is not specified.
+func (r *MetricCheckRule) Thresholds() (warning, critical InterruptedInterval) {
+	return r.WarningInterval, criticalThreshold(r.InterruptedInterval, r.CriticalInterval)
+}
+
+// Thresholds returns the intervals to be judged as WARNING and CRITICAL.
+// The warning interval is empty if it is not specified.
+func (r *ServiceMetricCheckRule) Thresholds() (warning, critical InterruptedInterval) {
+	return r.WarningInterval, criticalThreshold(r.InterruptedInterval, r.CriticalInterval)
+}
+
+// RequiredMetrics returns the number of metrics that must have been posted out of the total number of inspection metrics.
+func (r *MetricCheckRule) RequiredMetrics(total int) int {
+	return requiredMetrics(r.Match, r.MinPresent, total)
+}
+
+// RequiredMetrics returns the number of metrics that must have been posted out of the total number of inspection metrics.
+func (r *ServiceMetricCheckRule) RequiredMetrics(total int) int {
+	return requiredMetrics(r.Match, r.MinPresent, total)
+}
+
+// min_present is capped by the total, since the inspection metrics of a host vary with its provider.
+func requiredMetrics(match Match, minPresent, total int) int {
+	switch {
+	case minPresent > 0:
+		return min(minPresent, total)
+	case match == MatchAll:
+		return total
+	default:
+		return min(1, total)
+	}
+}
+
+func validateMatch(name string, match Match, minPresent int, p *rulePosition) error {
+	var err error
+	if match != "" && match != MatchAny && match != MatchAll {
+		err = errors.Join(err, p.wrap("match", fmt.Errorf("unsupported match, %s has been set. It supports any and all.", match)))
+	}
+	if minPresent < 0 {
+		err = errors.Join(err, p.wrap("min_present", fmt.Errorf("min_present must not be negative for check '%s'.", name)))
+	}
+	if match != "" && minPresent != 0 {
+		err = errors.Join(err, p.wrap("min_present", fmt.Errorf("Both match and min_present are specified for check '%s'. Please specify only one of them.", name)))
+	}
+	return err
+}
+
+// critical_interval takes precedence, and interrupted_interval is treated as an alias of it.
+func criticalThreshold(interrupted, critical InterruptedInterval) InterruptedInterval {
+	if critical != "" {
+		return critical
+	}
+	return interrupted
+}
+
+func validateThresholds(name string, interrupted, warning, critical InterruptedInterval, p *rulePosition) error {
+	var err error
+	if interrupted != "" && critical != "" {
+		err = errors.Join(err, p.wrap("critical_interval", fmt.Errorf("Both interrupted_interval and critical_interval are specified for check '%s'. Please specify only one of them.", name)))
+	}
+	err = errors.Join(err,
+		p.wrap("interrupted_interval", interrupted.validate()),
+		p.wrap("warning_interval", warning.validate()),
+		p.wrap("critical_interval", critical.validate()),
+	)
+	if warning != "" {
+		c := criticalThreshold(interrupted, critical)
+		if warning.ToValue() >= c.ToValue() {
+			err = errors.Join(err, p.wrap("warning_interval", fmt.Errorf("warning_interval(%s) must be shorter than critical_interval(%s) for check '%s'.", warning, c, name)))
+		}
 	}
 	return err
 }
 
 func (p InterruptedInterval) validate() error {
+	if p == "" {
+		return nil
+	}
 	d, err := time.ParseDuration(string(p))
-	if err == nil {
-		sec := d.Seconds()
-		if sec < 0 || float64(constants.MAX_INTERRUPTED_INTERVAL) < sec {
-			return fmt.Errorf("interrupted_interval out of range: %d", int32(sec))
-		}
+	if err != nil {
+		return fmt.Errorf("unparseable interval, %s has been set. It must be a duration such as 30m or 24h.", p)
+	}
+	sec := d.Seconds()
+	if sec < 0 || float64(constants.MAX_INTERRUPTED_INTERVAL) < sec {
+		return fmt.Errorf("interrupted_interval out of range: %d", int32(sec))
 	}
 	return nil
 }
@@ -83,6 +293,48 @@ func (p InterruptedInterval) ToValue() int32 {
 	return int32(d.Seconds())
 }
 
+func (s Strategy) validate() error {
+	if s != "" && s != StrategyWindow && s != StrategyLatest {
+		return fmt.Errorf("unsupported strategy, %s has been set. It supports window and latest.", s)
+	}
+	return nil
+}
+
+func (o OnAPIError) validate() error {
+	if o != "" && o != OnAPIErrorUnknown && o != OnAPIErrorSkip {
+		return fmt.Errorf("unsupported on_api_error, %s has been set. It supports unknown and skip.", o)
+	}
+	return nil
+}
+
+// Skip returns whether to skip reporting when the posting status could not be determined.
+// If unspecified, it is treated as OnAPIErrorUnknown.
+func (o OnAPIError) Skip() bool {
+	return o == OnAPIErrorSkip
+}
+
+func (s Schedule) validate() error {
+	if s == "" {
+		return nil
+	}
+	if _, err := s.Parse(); err != nil {
+		return fmt.Errorf("invalid schedule, %s has been set: %w", s, err)
+	}
+	return nil
+}
+
+// Parse returns the schedule to evaluate a rule.
+// An interval is parsed by time.ParseDuration, and anything else is parsed as a standard cron expression with 5 fields, which also accepts descriptors such as "@hourly".
+func (s Schedule) Parse() (cron.Schedule, error) {
+	if d, err := time.ParseDuration(string(s)); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("interval must be 1s or longer: %s", s)
+		}
+		return cron.Every(d), nil
+	}
+	return cron.ParseStandard(string(s))
+}
+
 func (p Provider) validate() error {
 	providers := constants.GetProviders()
 	if !slices.Contains(providers, string(p)) {
@@ -92,26 +344,92 @@ func (p Provider) validate() error {
 }
 
 // NewCheckConfig returns the configuration content loaded from YAML.
-func NewCheckConfig(ctx context.Context, confPath string) (*CheckConfig, error) {
-	u, err := url.Parse(confPath)
-	if err != nil {
-		return nil, err
+// Each path may refer to several files such as a directory or a glob pattern, see loader.Lister.
+// The rules of all the files are merged in order, and a rule name defined more than once is an error.
+func NewCheckConfig(ctx context.Context, confPaths ...string) (*CheckConfig, error) {
+	if len(confPaths) == 0 {
+		return nil, ErrNoSuchConfigFile
 	}
 
+	conf := &CheckConfig{}
+	// sources is the file where each rule name is defined.
+	sources := make(map[string]string)
+	var errs error
+	for _, confPath := range confPaths {
+		u, err := url.Parse(confPath)
+		if err != nil {
+			return nil, err
+		}
+		urls, err := loader.ListWithContext(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range urls {
+			c, err := loadCheckConfig(ctx, u)
+			if err != nil {
+				// The other files are loaded as well, so that all the problems are reported at once.
+				errs = errors.Join(errs, err)
+				continue
+			}
+			source := sourceOf(u)
+			for _, name := range c.ruleNames() {
+				if prev, ok := sources[name]; ok {
+					errs = errors.Join(errs, fmt.Errorf("The check '%s' is defined in both %s and %s.", name, prev, source))
+					continue
+				}
+				sources[name] = source
+			}
+			conf.Rules = append(conf.Rules, c.Rules...)
+			conf.ServiceRules = append(conf.ServiceRules, c.ServiceRules...)
+			conf.rulePositions = append(conf.rulePositions, c.rulePositions...)
+			conf.serviceRulePositions = append(conf.serviceRulePositions, c.serviceRulePositions...)
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return conf, nil
+}
+
+// loadCheckConfig returns the configuration loaded from a single file, in which the environment variables are expanded
+// and the defaults of the file are applied.
+func loadCheckConfig(ctx context.Context, u *url.URL) (*CheckConfig, error) {
 	buf, err := loader.LoadWithContext(ctx, u)
 	if err != nil {
 		return nil, err
 	}
 
 	conf := &CheckConfig{}
-	if err := yaml.Unmarshal(buf, conf); err != nil {
+	root, err := decodeStrict(sourceOf(u), buf, conf, os.LookupEnv)
+	if err != nil {
 		return nil, err
 	}
-	for i := 0; i < len(conf.Rules); i++ {
-		// If InterruptedInterval is unspecified, set it to a default value "24h".
-		if conf.Rules[i].InterruptedInterval == "" {
-			conf.Rules[i].InterruptedInterval = InterruptedInterval("24h")
+	conf.rulePositions = locateRules(sourceOf(u), root, "check")
+	conf.serviceRulePositions = locateRules(sourceOf(u), root, "service_check")
+	conf.applyDefaults()
+	return conf, nil
+}
+
+// ruleNames returns the names of the rules, in which the unnamed rules are omitted since they are rejected by Validate.
+func (c *CheckConfig) ruleNames() []string {
+	var names []string
+	for _, rule := range c.Rules {
+		if rule.Name != "" {
+			names = append(names, rule.Name)
+		}
+	}
+	for _, rule := range c.ServiceRules {
+		if rule.Name != "" {
+			names = append(names, rule.Name)
 		}
 	}
-	return conf, nil
+	return names
+}
+
+// sourceOf returns the location of the file to be shown in the messages, in which the credentials are redacted.
+func sourceOf(u *url.URL) string {
+	if u.Scheme == "" || u.Scheme == "file" {
+		return u.Path
+	}
+	return u.Redacted()
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -36,13 +37,50 @@ func TestConfigLoad(t *testing.T) {
 		},
 	}
 
-	assert.EqualValues(t, cases, conf)
+	assert.EqualValues(t, cases.Rules, conf.Rules)
+	assert.Empty(t, conf.ServiceRules)
+}
+
+func TestServiceConfigLoad(t *testing.T) {
+	conf, err := NewCheckConfig(context.TODO(), "testdata/check_service.yml")
+	assert.NoError(t, err)
+
+	cases := &CheckConfig{
+		ServiceRules: []ServiceMetricCheckRule{
+			{
+				Name:                "kpi",
+				Service:             "hoge_service",
+				InterruptedInterval: "6h",
+				InspectionMetrics:   []string{"kpi.orders.count", "kpi.users.active"},
+				ReportHostID:        "3Xyz12abcDE",
+			},
+			{
+				Name:                "batch",
+				Service:             "foo_service",
+				InterruptedInterval: "24h",
+				InspectionMetrics:   []string{"batch.elapsed"},
+				ReportHostID:        "3Xyz12abcDE",
+			},
+		},
+	}
+
+	assert.Empty(t, conf.Rules)
+	assert.EqualValues(t, cases.ServiceRules, conf.ServiceRules)
+	assert.NoError(t, conf.Validate())
+}
+
+func TestServiceRuleValidation(t *testing.T) {
+	rule := &ServiceMetricCheckRule{Name: "kpi", InterruptedInterval: "24h"}
+	err := rule.validate()
+	assert.ErrorContains(t, err, "Service not specified for service check 'kpi'.")
+	assert.ErrorContains(t, err, "No inspection metrics specified for service check 'kpi'.")
+	assert.ErrorContains(t, err, "The host to report to is not specified for service check 'kpi'.")
 }
 
 func TestConfigFileLoading(t *testing.T) {
 	var cc *CheckConfig
 	var err error
-	_, err = NewCheckConfig(context.TODO(), "testdata")
+	_, err = NewCheckConfig(context.TODO())
 	assert.EqualError(t, ErrNoSuchConfigFile, err.Error())
 	_, err = NewCheckConfig(context.TODO(), "testdata/empty.yml")
 	assert.EqualError(t, ErrEmptyConfigFile, err.Error())
@@ -51,6 +89,56 @@ func TestConfigFileLoading(t *testing.T) {
 	assert.Equal(t, nil, err)
 }
 
+func TestMultipleConfigLoad(t *testing.T) {
+	names := func(conf *CheckConfig) []string {
+		var n []string
+		for _, rule := range conf.Rules {
+			n = append(n, rule.Name)
+		}
+		for _, rule := range conf.ServiceRules {
+			n = append(n, rule.Name)
+		}
+		return n
+	}
+
+	conf, err := NewCheckConfig(context.TODO(), "testdata/conf.d")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b", "team-b-kpi"}, names(conf))
+	assert.Equal(t, defaultInterruptedInterval, conf.Rules[0].InterruptedInterval)
+
+	conf, err = NewCheckConfig(context.TODO(), "testdata/conf.d/*.yml", "testdata/check.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "hoge", "foo"}, names(conf))
+
+	_, err = NewCheckConfig(context.TODO(), "testdata/check.yml", "testdata/duplicate/check.yml", "testdata/check.yml")
+	assert.ErrorContains(t, err, "The check 'hoge' is defined in both testdata/check.yml and testdata/duplicate/check.yml.")
+	assert.ErrorContains(t, err, "The check 'foo' is defined in both testdata/check.yml and testdata/check.yml.")
+}
+
+func TestStrictConfigLoad(t *testing.T) {
+	_, err := NewCheckConfig(context.TODO(), "testdata/invalid.yml", "testdata/broken.yml")
+	assert.ErrorContains(t, err, "testdata/invalid.yml:5:5: Unknown field 'interupted_interval'.")
+	assert.ErrorContains(t, err, "testdata/invalid.yml:7:9: unsupported provider, ec3 has been set")
+	assert.ErrorContains(t, err, "testdata/invalid.yml:10:27: unparseable interval, 1 day has been set.")
+	assert.ErrorContains(t, err, "testdata/invalid.yml:11:18: cannot unmarshal !!str `many` into int")
+	assert.ErrorContains(t, err, "testdata/invalid.yml:12:1: Unknown field 'servce_check'.")
+	assert.ErrorContains(t, err, "testdata/broken.yml:4: did not find expected node content")
+}
+
+func TestValidationPosition(t *testing.T) {
+	conf, err := NewCheckConfig(context.TODO(), "testdata/check.yml", "testdata/unvalidated.yml")
+	assert.NoError(t, err)
+	err = conf.Validate()
+	assert.ErrorContains(t, err, "testdata/unvalidated.yml:3:5: Service not specified for check 'no-service'.")
+	assert.ErrorContains(t, err, "testdata/unvalidated.yml:6:23: warning_interval(24h) must be shorter than critical_interval(6h) for check 'staged'.")
+	assert.ErrorContains(t, err, "testdata/unvalidated.yml:11:18: Both match and min_present are specified for check 'both'.")
+	assert.ErrorContains(t, err, "testdata/unvalidated.yml:13:5: No inspection metrics specified for service check 'kpi'.")
+	assert.NotContains(t, err.Error(), "testdata/check.yml")
+
+	_, err = NewCheckConfig(context.TODO(), "testdata/invalid_schedule.yml")
+	assert.ErrorContains(t, err, "testdata/invalid_schedule.yml:5:15: invalid schedule, every 5 minutes has been set")
+}
+
 func TestInterruptedInterval(t *testing.T) {
 	cases := []struct {
 		interval InterruptedInterval
@@ -78,6 +166,11 @@ func TestInterruptedInterval(t *testing.T) {
 			expected: (60*60*24*30 + 60*60),
 			err:      "interrupted_interval out of range: 2595600",
 		},
+		{ // An unparseable interval is rejected rather than treated as 0 seconds.
+			interval: "1 day",
+			expected: 0,
+			err:      "unparseable interval, 1 day has been set. It must be a duration such as 30m or 24h.",
+		},
 	}
 	for _, c := range cases {
 		t.Run(string(c.interval), func(t *testing.T) {
@@ -91,6 +184,140 @@ func TestInterruptedInterval(t *testing.T) {
 	}
 }
 
+func TestThresholdsValidation(t *testing.T) {
+	cases := []struct {
+		name     string
+		rule     MetricCheckRule
+		warning  InterruptedInterval
+		critical InterruptedInterval
+		err      string
+	}{
+		{
+			name:     "interrupted_interval only",
+			rule:     MetricCheckRule{Name: "r", Service: "s", InterruptedInterval: "24h"},
+			critical: "24h",
+		},
+		{
+			name:     "staged",
+			rule:     MetricCheckRule{Name: "r", Service: "s", WarningInterval: "6h", CriticalInterval: "24h"},
+			warning:  "6h",
+			critical: "24h",
+		},
+		{
+			name:     "warning with interrupted_interval",
+			rule:     MetricCheckRule{Name: "r", Service: "s", InterruptedInterval: "12h", WarningInterval: "1h"},
+			warning:  "1h",
+			critical: "12h",
+		},
+		{ // Verify that the warning threshold must be shorter than the critical one.
+			name:     "warning is longer",
+			rule:     MetricCheckRule{Name: "r", Service: "s", WarningInterval: "24h", CriticalInterval: "6h"},
+			warning:  "24h",
+			critical: "6h",
+			err:      "warning_interval(24h) must be shorter than critical_interval(6h) for check 'r'.",
+		},
+		{
+			name:     "both critical and interrupted",
+			rule:     MetricCheckRule{Name: "r", Service: "s", InterruptedInterval: "12h", CriticalInterval: "24h"},
+			critical: "24h",
+			err:      "Both interrupted_interval and critical_interval are specified for check 'r'. Please specify only one of them.",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			warning, critical := c.rule.Thresholds()
+			assert.Equal(t, c.warning, warning)
+			assert.Equal(t, c.critical, critical)
+			if c.err == "" {
+				assert.NoError(t, c.rule.validate())
+			} else {
+				assert.EqualError(t, c.rule.validate(), c.err)
+			}
+		})
+	}
+}
+
+func TestOnAPIErrorValidation(t *testing.T) {
+	assert.NoError(t, OnAPIError("").validate())
+	assert.NoError(t, OnAPIErrorUnknown.validate())
+	assert.NoError(t, OnAPIErrorSkip.validate())
+	assert.EqualError(t, OnAPIError("critical").validate(), "unsupported on_api_error, critical has been set. It supports unknown and skip.")
+	assert.False(t, OnAPIError("").Skip())
+	assert.True(t, OnAPIErrorSkip.Skip())
+}
+
+func TestInspectionMetricsValidation(t *testing.T) {
+	rule := &MetricCheckRule{
+		Name:                "r",
+		Service:             "s",
+		InterruptedInterval: "24h",
+		InspectionMetrics: map[string][]string{
+			"agent": {"custom.nginx.*", "/^custom\\.php-fpm\\./"},
+		},
+	}
+	assert.NoError(t, rule.validate())
+
+	rule.InspectionMetrics["agent"] = append(rule.InspectionMetrics["agent"], "/custom.(nginx/")
+	assert.ErrorContains(t, rule.validate(), "Invalid inspection metric for check 'r': invalid regular expression /custom.(nginx/")
+}
+
+func TestRequiredMetrics(t *testing.T) {
+	cases := []struct {
+		name     string
+		rule     MetricCheckRule
+		total    int
+		expected int
+	}{
+		{name: "default", rule: MetricCheckRule{}, total: 3, expected: 1},
+		{name: "any", rule: MetricCheckRule{Match: MatchAny}, total: 3, expected: 1},
+		{name: "all", rule: MetricCheckRule{Match: MatchAll}, total: 3, expected: 3},
+		{name: "min_present", rule: MetricCheckRule{MinPresent: 2}, total: 3, expected: 2},
+		{name: "min_present is capped", rule: MetricCheckRule{MinPresent: 5}, total: 3, expected: 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.rule.RequiredMetrics(c.total))
+		})
+	}
+}
+
+func TestMatchValidation(t *testing.T) {
+	assert.NoError(t, validateMatch("r", "", 0, nil))
+	assert.NoError(t, validateMatch("r", MatchAll, 0, nil))
+	assert.NoError(t, validateMatch("r", "", 2, nil))
+	assert.EqualError(t, validateMatch("r", "some", 0, nil), "unsupported match, some has been set. It supports any and all.")
+	assert.EqualError(t, validateMatch("r", "", -1, nil), "min_present must not be negative for check 'r'.")
+	assert.EqualError(t, validateMatch("r", MatchAll, 2, nil), "Both match and min_present are specified for check 'r'. Please specify only one of them.")
+}
+
+func TestStrategyValidation(t *testing.T) {
+	assert.NoError(t, Strategy("").validate())
+	assert.NoError(t, StrategyWindow.validate())
+	assert.NoError(t, StrategyLatest.validate())
+	assert.EqualError(t, Strategy("oldest").validate(), "unsupported strategy, oldest has been set. It supports window and latest.")
+}
+
+func TestScheduleValidation(t *testing.T) {
+	assert.NoError(t, Schedule("").validate())
+	assert.NoError(t, Schedule("5m").validate())
+	assert.NoError(t, Schedule("*/10 * * * *").validate())
+	assert.NoError(t, Schedule("@hourly").validate())
+	assert.ErrorContains(t, Schedule("100ms").validate(), "invalid schedule, 100ms has been set: interval must be 1s or longer")
+	assert.ErrorContains(t, Schedule("every 5 minutes").validate(), "invalid schedule, every 5 minutes has been set")
+}
+
+func TestScheduleParse(t *testing.T) {
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	interval, err := Schedule("5m").Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, base.Add(5*time.Minute), interval.Next(base))
+
+	expr, err := Schedule("*/10 * * * *").Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 10, 0, 0, time.UTC), expr.Next(base))
+}
+
 func TestProviderValidation(t *testing.T) {
 	cases := []struct {
 		provider Provider
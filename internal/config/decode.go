@@ -0,0 +1,200 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlLineRe matches the line number in the messages of the yaml package, e.g. "yaml: line 3: did not find expected key".
+var yamlLineRe = regexp.MustCompile(`line (\d+): (.*)`)
+
+// fieldValidator is implemented by the types of the fields that can be validated by their value alone.
+type fieldValidator interface {
+	validate() error
+}
+
+// decodeStrict decodes the YAML into out like yaml.Unmarshal, but rejects the unknown fields, the values of wrong types
+// and the invalid values of the fields implementing fieldValidator. Every problem is reported with the source, line and column.
+// The environment variables are expanded in the values with lookupEnv before the checks, see expandNode.
+// It returns the root node of the document, or nil if the document is empty.
+func decodeStrict(source string, buf []byte, out any, lookupEnv func(string) (string, bool)) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, syntaxError(source, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	if err := expandNode(source, &doc, lookupEnv); err != nil {
+		return nil, err
+	}
+	if err := checkNode(source, doc.Content[0], reflect.TypeOf(out).Elem()); err != nil {
+		return nil, err
+	}
+	if err := doc.Decode(out); err != nil {
+		return nil, syntaxError(source, err)
+	}
+	return doc.Content[0], nil
+}
+
+// checkNode checks the node against the type which it is decoded into, and joins all the problems found.
+func checkNode(source string, n *yaml.Node, t reflect.Type) error {
+	n = resolveAlias(n)
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null" {
+		return nil
+	}
+
+	var err error
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			f, ok := fields[key.Value]
+			if !ok {
+				err = errors.Join(err, positionError(source, key, fmt.Errorf("Unknown field '%s'.", key.Value)))
+				continue
+			}
+			err = errors.Join(err, checkNode(source, value, f))
+		}
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for _, item := range n.Content {
+			err = errors.Join(err, checkNode(source, item, t.Elem()))
+		}
+	case t.Kind() == reflect.Map && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			err = errors.Join(err, checkNode(source, n.Content[i], t.Key()), checkNode(source, n.Content[i+1], t.Elem()))
+		}
+	default:
+		v := reflect.New(t)
+		if e := n.Decode(v.Interface()); e != nil {
+			return positionError(source, n, unmarshalError(e))
+		}
+		if fv, ok := v.Elem().Interface().(fieldValidator); ok {
+			if e := fv.validate(); e != nil {
+				return positionError(source, n, e)
+			}
+		}
+	}
+	return err
+}
+
+// yamlFields returns the types of the fields of the struct by their names in YAML.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// rulePosition is where a rule is defined, so that the problems found by the validation are reported with the position
+// as well as the ones found by decodeStrict.
+type rulePosition struct {
+	source string
+	node   *yaml.Node
+	// fields is the values of the fields by their names in YAML.
+	fields map[string]*yaml.Node
+}
+
+// wrap adds the position of the field to the error, or the position of the rule if the field is not specified.
+// The error is returned as it is if the position is unknown.
+func (p *rulePosition) wrap(field string, err error) error {
+	if p == nil || err == nil {
+		return err
+	}
+	n, ok := p.fields[field]
+	if !ok {
+		n = p.node
+	}
+	return positionError(p.source, n, err)
+}
+
+// locateRules returns the positions of the rules in the sequence of the key, in the same order as they are decoded.
+func locateRules(source string, root *yaml.Node, key string) []*rulePosition {
+	seq := mappingValue(root, key)
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return nil
+	}
+	positions := make([]*rulePosition, 0, len(seq.Content))
+	for _, item := range seq.Content {
+		item = resolveAlias(item)
+		p := &rulePosition{source: source, node: item, fields: make(map[string]*yaml.Node)}
+		if item.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(item.Content); i += 2 {
+				p.fields[item.Content[i].Value] = resolveAlias(item.Content[i+1])
+			}
+		}
+		positions = append(positions, p)
+	}
+	return positions
+}
+
+// mappingValue returns the value of the key in the mapping node, or nil if it is not found.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	n = resolveAlias(n)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return resolveAlias(n.Content[i+1])
+		}
+	}
+	return nil
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	if n != nil && n.Kind == yaml.AliasNode && n.Alias != nil {
+		return n.Alias
+	}
+	return n
+}
+
+func positionError(source string, n *yaml.Node, err error) error {
+	return fmt.Errorf("%s:%d:%d: %w", source, n.Line, n.Column, err)
+}
+
+// syntaxError adds the source to the error of the yaml package, in which the line number is kept but the column is unknown.
+func syntaxError(source string, err error) error {
+	var errs error
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if m := yamlLineRe.FindStringSubmatch(line); m != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s:%s: %s", source, m[1], m[2]))
+		}
+	}
+	if errs == nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	return errs
+}
+
+// unmarshalError removes the line number from the error of the yaml package, since the position is added by positionError.
+func unmarshalError(err error) error {
+	var msgs []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if m := yamlLineRe.FindStringSubmatch(line); m != nil {
+			msgs = append(msgs, m[2])
+		}
+	}
+	if len(msgs) == 0 {
+		return err
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
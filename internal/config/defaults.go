@@ -0,0 +1,102 @@
+package config
+
+import (
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleDefaults is the values applied to the rules in which they are not specified.
+// The thresholds and the conditions of the inspection metrics are applied as a group respectively,
+// since they depend on each other, e.g. a rule specifying min_present does not inherit match.
+type RuleDefaults struct {
+	InterruptedInterval InterruptedInterval `yaml:"interrupted_interval,omitempty"`
+	WarningInterval     InterruptedInterval `yaml:"warning_interval,omitempty"`
+	CriticalInterval    InterruptedInterval `yaml:"critical_interval,omitempty"`
+	Providers           []Provider          `yaml:"providers,omitempty"`
+	OnAPIError          OnAPIError          `yaml:"on_api_error,omitempty"`
+	Strategy            Strategy            `yaml:"strategy,omitempty"`
+	Match               Match               `yaml:"match,omitempty"`
+	MinPresent          int                 `yaml:"min_present,omitempty"`
+	Schedule            Schedule            `yaml:"schedule,omitempty"`
+}
+
+// ProviderDefaults is the values applied to the rules for the hosts of a provider.
+type ProviderDefaults struct {
+	// InspectionMetrics is used for the provider unless the rule specifies the inspection metrics for it.
+	InspectionMetrics []string `yaml:"inspection_metrics,omitempty"`
+}
+
+// applyDefaults applies the defaults to the rules, and then the defaults of the interval if no threshold is specified.
+func (c *CheckConfig) applyDefaults() {
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		d := c.Defaults
+		if r.InterruptedInterval == "" && r.WarningInterval == "" && r.CriticalInterval == "" {
+			r.InterruptedInterval, r.WarningInterval, r.CriticalInterval = d.InterruptedInterval, d.WarningInterval, d.CriticalInterval
+		}
+		if r.Match == "" && r.MinPresent == 0 {
+			r.Match, r.MinPresent = d.Match, d.MinPresent
+		}
+		if len(r.Providers) == 0 {
+			r.Providers = slices.Clone(d.Providers)
+		}
+		r.OnAPIError = or(r.OnAPIError, d.OnAPIError)
+		r.Strategy = or(r.Strategy, d.Strategy)
+		r.Schedule = or(r.Schedule, d.Schedule)
+
+		for provider, pd := range c.ProviderDefaults {
+			if len(pd.InspectionMetrics) == 0 || (len(r.Providers) > 0 && !slices.Contains(r.Providers, provider)) {
+				continue
+			}
+			if _, ok := r.InspectionMetrics[string(provider)]; ok {
+				continue
+			}
+			if r.InspectionMetrics == nil {
+				r.InspectionMetrics = make(map[string][]string)
+			}
+			r.InspectionMetrics[string(provider)] = slices.Clone(pd.InspectionMetrics)
+		}
+
+		// If InterruptedInterval is unspecified, set it to a default value "24h".
+		if r.InterruptedInterval == "" && r.CriticalInterval == "" {
+			r.InterruptedInterval = defaultInterruptedInterval
+		}
+	}
+	for i := range c.ServiceRules {
+		r := &c.ServiceRules[i]
+		d := c.Defaults
+		if r.InterruptedInterval == "" && r.WarningInterval == "" && r.CriticalInterval == "" {
+			r.InterruptedInterval, r.WarningInterval, r.CriticalInterval = d.InterruptedInterval, d.WarningInterval, d.CriticalInterval
+		}
+		if r.Match == "" && r.MinPresent == 0 {
+			r.Match, r.MinPresent = d.Match, d.MinPresent
+		}
+		r.OnAPIError = or(r.OnAPIError, d.OnAPIError)
+		r.Schedule = or(r.Schedule, d.Schedule)
+
+		if r.InterruptedInterval == "" && r.CriticalInterval == "" {
+			r.InterruptedInterval = defaultInterruptedInterval
+		}
+	}
+	c.Defaults = RuleDefaults{}
+	c.ProviderDefaults = nil
+}
+
+// or returns the value if it is specified, otherwise the default.
+func or[T comparable](v, defaultValue T) T {
+	var zero T
+	if v == zero {
+		return defaultValue
+	}
+	return v
+}
+
+// Dump returns the configuration in YAML, in which the rules are shown with the defaults applied.
+func (c *CheckConfig) Dump() string {
+	buf, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+	return string(buf)
+}
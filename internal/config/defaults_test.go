@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	conf, err := NewCheckConfig(context.TODO(), "testdata/defaults.yml", "testdata/check_service.yml")
+	assert.NoError(t, err)
+	assert.NoError(t, conf.Validate())
+
+	expected := &CheckConfig{
+		Rules: []MetricCheckRule{
+			{
+				Name:                "inherit",
+				Service:             "hoge_service",
+				InterruptedInterval: "6h",
+				Providers:           []Provider{"ec2", "rds"},
+				InspectionMetrics: map[string][]string{
+					"ec2": {"custom.nginx.requests"},
+					"rds": {"custom.rds.connections"},
+				},
+				Strategy: StrategyLatest,
+				Match:    MatchAll,
+				Schedule: "5m",
+			},
+			{
+				// The thresholds and the conditions are not mixed with the defaults.
+				Name:                "override",
+				Service:             "foo_service",
+				InterruptedInterval: "24h",
+				WarningInterval:     "1h",
+				Providers:           []Provider{"ec2"},
+				InspectionMetrics: map[string][]string{
+					"ec2": {"custom.foo.bar"},
+				},
+				Strategy:   StrategyWindow,
+				MinPresent: 2,
+				Schedule:   "5m",
+			},
+		},
+		ServiceRules: []ServiceMetricCheckRule{
+			{
+				Name:                "kpi-defaults",
+				Service:             "hoge_service",
+				InterruptedInterval: "6h",
+				InspectionMetrics:   []string{"kpi.orders.count"},
+				ReportHostID:        "3Xyz12abcDE",
+				Match:               MatchAll,
+				Schedule:            "5m",
+			},
+			// The defaults are not applied to the rules of the other files.
+			{
+				Name:                "kpi",
+				Service:             "hoge_service",
+				InterruptedInterval: "6h",
+				InspectionMetrics:   []string{"kpi.orders.count", "kpi.users.active"},
+				ReportHostID:        "3Xyz12abcDE",
+			},
+			{
+				Name:                "batch",
+				Service:             "foo_service",
+				InterruptedInterval: "24h",
+				InspectionMetrics:   []string{"batch.elapsed"},
+				ReportHostID:        "3Xyz12abcDE",
+			},
+		},
+	}
+	assert.EqualValues(t, expected.Rules, conf.Rules)
+	assert.EqualValues(t, expected.ServiceRules, conf.ServiceRules)
+}
+
+func TestDump(t *testing.T) {
+	conf, err := NewCheckConfig(context.TODO(), "testdata/defaults.yml")
+	assert.NoError(t, err)
+
+	dump := conf.Dump()
+	assert.NotContains(t, dump, "provider_defaults")
+	assert.True(t, strings.HasPrefix(dump, "check:\n    - name: inherit\n      service: hoge_service\n      interrupted_interval: 6h\n"), dump)
+	assert.Contains(t, dump, "custom.rds.connections")
+}
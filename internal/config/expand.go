@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envRefPattern matches the values referencing an environment variable, which are accepted by the JSON Schema
+// in place of any scalar value since they are expanded before the validation.
+const envRefPattern = `(^|[^$])\$\{[A-Za-z_][A-Za-z0-9_]*(:-[^}]*)?\}`
+
+// envNameRe matches the names of the environment variables which can be referenced in the configuration.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// expandNode replaces ${NAME} and ${NAME:-default} in the scalar values of the document with the environment variables
+// looked up. The default is used if the variable is unset or empty, and $${ is left as ${.
+// A reference to an unset variable without a default is an error, so that a typo is not replaced with an empty string.
+// Since the values are expanded after parsing, a value cannot change the structure of the document even if it contains
+// a newline or a quote, and the comments and the keys are left as they are.
+// A plain value is resolved again after the expansion, so that ${MIN_PRESENT} can be an integer for example.
+func expandNode(source string, n *yaml.Node, lookup func(string) (string, bool)) error {
+	var errs error
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			errs = errors.Join(errs, expandNode(source, c, lookup))
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			errs = errors.Join(errs, expandNode(source, n.Content[i+1], lookup))
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		value, refErrs := expandEnv(n.Value, lookup)
+		for _, err := range refErrs {
+			errs = errors.Join(errs, positionError(source, n, err))
+		}
+		n.Value = value
+		if n.Style&(yaml.TaggedStyle|yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			n.Tag = ""
+		}
+	}
+	// The aliases are not followed, since the anchored nodes are expanded where they are defined.
+	return errs
+}
+
+// expandEnv returns the value in which the references to the environment variables are expanded, and the problems
+// of the references.
+func expandEnv(s string, lookup func(string) (string, bool)) (string, []error) {
+	var out strings.Builder
+	var errs []error
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			out.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			ref, value, err := expandRef(s[i:], lookup)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			out.WriteString(value)
+			i += len(ref)
+		default:
+			out.WriteByte(s[i])
+			i++
+		}
+	}
+	return out.String(), errs
+}
+
+// expandRef expands the reference at the beginning of s, and returns the reference and its value.
+func expandRef(s string, lookup func(string) (string, bool)) (string, string, error) {
+	end := strings.IndexByte(s, '}')
+	if end < 0 {
+		return s, "", fmt.Errorf("Unterminated variable reference '%s'. Write $${ to use ${ as it is.", s)
+	}
+	ref := s[:end+1]
+	name, defaultValue, hasDefault := strings.Cut(ref[2:end], ":-")
+	if !envNameRe.MatchString(name) {
+		return ref, "", fmt.Errorf("Invalid variable reference '%s'. Write $${ to use ${ as it is.", ref)
+	}
+	value, ok := lookup(name)
+	if hasDefault && value == "" {
+		return ref, defaultValue, nil
+	}
+	if !ok {
+		return ref, "", fmt.Errorf("The environment variable %s is not set. Set it or specify a default such as ${%s:-default}.", name, name)
+	}
+	return ref, value, nil
+}
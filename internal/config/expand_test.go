@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"STAGE": "production", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	cases := []struct {
+		in       string
+		expected string
+		err      []string
+	}{
+		{in: "web-${STAGE}", expected: "web-production"},
+		{in: "${UNSET:-web}", expected: "web"},
+		{in: "${EMPTY:-web}", expected: "web"},
+		{in: "web${EMPTY}", expected: "web"},
+		{in: "${STAGE:-}", expected: "production"},
+		{ // $${ is an escape, and $ without a brace is left as it is.
+			in:       "$${STAGE} $STAGE /^foo$/",
+			expected: "${STAGE} $STAGE /^foo$/",
+		},
+		{
+			in: "${SERVCE}-${UNSET}",
+			err: []string{
+				"The environment variable SERVCE is not set.",
+				"The environment variable UNSET is not set.",
+			},
+		},
+		{in: "${STAGE-web}", err: []string{"Invalid variable reference '${STAGE-web}'."}},
+		{in: "web-${STAGE", err: []string{"Unterminated variable reference '${STAGE'."}},
+	}
+	for _, c := range cases {
+		out, errs := expandEnv(c.in, lookup)
+		if c.err != nil {
+			assert.Len(t, errs, len(c.err), c.in)
+			for i, e := range c.err {
+				assert.ErrorContains(t, errs[i], e, c.in)
+			}
+			continue
+		}
+		assert.Empty(t, errs, c.in)
+		assert.Equal(t, c.expected, out)
+	}
+}
+
+func TestExpandEnvConfigLoad(t *testing.T) {
+	t.Setenv("IKESU_TEST_STAGE", "staging")
+	t.Setenv("IKESU_TEST_SERVICE", "blog-staging")
+	conf, err := NewCheckConfig(context.TODO(), "testdata/expand.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "front-staging", conf.Rules[0].Name)
+	assert.Equal(t, "blog-staging", conf.Rules[0].Service)
+	assert.Equal(t, InterruptedInterval("24h"), conf.Rules[0].InterruptedInterval)
+	assert.Equal(t, 1, conf.Rules[0].MinPresent)
+	assert.Equal(t, []string{"custom.${name}.count"}, conf.Rules[0].InspectionMetrics["agent"])
+
+	// A plain value is an integer if the expanded value is.
+	t.Setenv("IKESU_TEST_INTERVAL", "6h")
+	t.Setenv("IKESU_TEST_MIN_PRESENT", "2")
+	conf, err = NewCheckConfig(context.TODO(), "testdata/expand.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, InterruptedInterval("6h"), conf.Rules[0].InterruptedInterval)
+	assert.Equal(t, 2, conf.Rules[0].MinPresent)
+
+	// The values cannot change the structure of the document, since they are expanded after parsing.
+	t.Setenv("IKESU_TEST_SERVICE", "blog\"\n    roles: [evil]")
+	conf, err = NewCheckConfig(context.TODO(), "testdata/expand.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "blog\"\n    roles: [evil]", conf.Rules[0].Service)
+	assert.Empty(t, conf.Rules[0].Roles)
+
+	// The problems are reported with the positions of the values, and checked as the other values.
+	t.Setenv("IKESU_TEST_MIN_PRESENT", "many")
+	_, err = NewCheckConfig(context.TODO(), "testdata/expand.yml")
+	assert.ErrorContains(t, err, "testdata/expand.yml:5:16: cannot unmarshal !!str `many` into int")
+	t.Setenv("IKESU_TEST_MIN_PRESENT", "")
+	t.Setenv("IKESU_TEST_INTERVAL", "1 day")
+	_, err = NewCheckConfig(context.TODO(), "testdata/expand.yml")
+	assert.ErrorContains(t, err, "testdata/expand.yml:4:25: unparseable interval, 1 day has been set.")
+
+	t.Setenv("IKESU_TEST_INTERVAL", "")
+	assert.NoError(t, os.Unsetenv("IKESU_TEST_STAGE"))
+	_, err = NewCheckConfig(context.TODO(), "testdata/expand.yml")
+	assert.ErrorContains(t, err, "testdata/expand.yml:7:11: The environment variable IKESU_TEST_STAGE is not set.")
+}
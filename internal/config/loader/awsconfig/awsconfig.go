@@ -0,0 +1,49 @@
+// Package awsconfig resolves the AWS configuration shared by the loaders of the AWS services.
+package awsconfig
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// DefaultRegion is used when the region is neither specified in the URL nor resolved from the environment.
+const DefaultRegion = "ap-northeast-1"
+
+// Load returns the AWS configuration for the URL of a loader, which accepts the query parameters below.
+//
+//	regionHint  the region of the resource.
+//	endpoint    the endpoint to send the requests to instead of AWS, e.g. http://localhost:4566 for LocalStack.
+//	profile     the profile of the shared configuration.
+//
+// The credentials and the others are resolved from the environment in the same way as the AWS CLI.
+func Load(ctx context.Context, u *url.URL) (aws.Config, error) {
+	q := u.Query()
+	var opts []func(*config.LoadOptions) error
+	if rh := strings.TrimSpace(q.Get("regionHint")); rh != "" {
+		opts = append(opts, config.WithRegion(rh))
+	}
+	if profile := strings.TrimSpace(q.Get("profile")); profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultRegion
+	}
+	if endpoint := strings.TrimSpace(q.Get("endpoint")); endpoint != "" {
+		cfg.BaseEndpoint = aws.String(endpoint)
+	}
+	return cfg, nil
+}
+
+// Name returns the name of the resource in the URL, e.g. "/ikesu/check" for ssm:///ikesu/check and "ikesu/check" for ssm://ikesu/check.
+func Name(u *url.URL) string {
+	return u.Host + u.Path
+}
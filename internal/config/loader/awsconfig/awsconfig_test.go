@@ -0,0 +1,52 @@
+package awsconfig
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func isolate(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+}
+
+func TestLoad(t *testing.T) {
+	isolate(t)
+
+	cfg, err := Load(context.Background(), &url.URL{Scheme: "ssm", Path: "/ikesu/check"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRegion, cfg.Region)
+	assert.Nil(t, cfg.BaseEndpoint)
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	cfg, err = Load(context.Background(), &url.URL{Scheme: "ssm", Path: "/ikesu/check"})
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", cfg.Region)
+
+	u, _ := url.Parse("ssm:///ikesu/check?regionHint=eu-west-1&endpoint=http://localhost:4566")
+	cfg, err = Load(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", cfg.Region)
+	assert.Equal(t, aws.String("http://localhost:4566"), cfg.BaseEndpoint)
+
+	u, _ = url.Parse("ssm:///ikesu/check?profile=missing")
+	_, err = Load(context.Background(), u)
+	assert.Error(t, err)
+}
+
+func TestName(t *testing.T) {
+	u, _ := url.Parse("ssm:///ikesu/check.yml")
+	assert.Equal(t, "/ikesu/check.yml", Name(u))
+	u, _ = url.Parse("secretsmanager://ikesu/check")
+	assert.Equal(t, "ikesu/check", Name(u))
+}
@@ -0,0 +1,194 @@
+package azblob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+
+	"github.com/tukaelu/ikesu/internal/config/loader"
+)
+
+func init() {
+	loader.Register("azblob", &Loader{})
+}
+
+// Loader loads the configuration from a blob of Azure Blob Storage.
+// e.g. azblob://account/container/blob
+//
+// It is authenticated with the account key in AZURE_STORAGE_KEY if set, otherwise with DefaultAzureCredential.
+// It accepts the query parameters below.
+//
+//	versionId     the version of the blob.
+//	endpoint      the URL of the storage account such as Azurite, e.g. http://127.0.0.1:10000/devstoreaccount1
+//	pollInterval  the interval to check whether the blob has been updated in the serve mode.
+//
+// A blob name ending with a slash or a glob pattern refers to several blobs, see ListWithContext.
+type Loader struct{}
+
+func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	client, err := newBlobClient(u)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", u.Redacted(), err)
+	}
+	defer res.Body.Close()
+	return io.ReadAll(res.Body)
+}
+
+// ListWithContext returns the YAML blobs (*.yml and *.yaml) under a prefix ending with a slash, e.g. azblob://account/container/conf.d/,
+// or the blobs matching a glob pattern of path.Match, e.g. azblob://account/container/conf.d/*.yml, in lexical order.
+func (d *Loader) ListWithContext(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	client, name, err := newContainerClient(u)
+	if err != nil {
+		return nil, err
+	}
+	if !loader.IsMultiObject(name) {
+		return []*url.URL{u}, nil
+	}
+	if strings.TrimSpace(u.Query().Get("versionId")) != "" {
+		return nil, fmt.Errorf("versionId cannot be specified for several blobs, since it is the version of a single blob: azblob://%s%s", u.Host, u.Path)
+	}
+	blobs, err := listBlobs(ctx, client, u, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(blobs) == 0 {
+		return nil, fmt.Errorf("No config blob matches azblob://%s%s.", u.Host, u.Path)
+	}
+	containerName, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	urls := make([]*url.URL, 0, len(blobs))
+	for _, b := range blobs {
+		v := *u
+		v.Path = "/" + containerName + "/" + *b.Name
+		urls = append(urls, &v)
+	}
+	return urls, nil
+}
+
+func listBlobs(ctx context.Context, client *container.Client, u *url.URL, name string) ([]*container.BlobItem, error) {
+	prefix, match := loader.ObjectMatcher(name)
+	var blobs []*container.BlobItem
+	pager := client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		res, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list %s: %w", u.Redacted(), err)
+		}
+		for _, b := range res.Segment.BlobItems {
+			if b.Name != nil && match(*b.Name) {
+				blobs = append(blobs, b)
+			}
+		}
+	}
+	slices.SortFunc(blobs, func(a, b *container.BlobItem) int {
+		return strings.Compare(*a.Name, *b.Name)
+	})
+	return blobs, nil
+}
+
+// WatchWithContext polls the ETag of the blob, and notifies when it changes.
+// For several blobs, the addition and the removal of the blobs are also notified.
+func (d *Loader) WatchWithContext(ctx context.Context, u *url.URL) (<-chan struct{}, error) {
+	interval, err := loader.PollInterval(u)
+	if err != nil {
+		return nil, err
+	}
+	containerClient, name, err := newContainerClient(u)
+	if err != nil {
+		return nil, err
+	}
+	if loader.IsMultiObject(name) {
+		return loader.Poll(ctx, interval, func(ctx context.Context) (string, error) {
+			blobs, err := listBlobs(ctx, containerClient, u, name)
+			if err != nil {
+				return "", err
+			}
+			var versions []string
+			for _, b := range blobs {
+				etag := ""
+				if b.Properties != nil && b.Properties.ETag != nil {
+					etag = string(*b.Properties.ETag)
+				}
+				versions = append(versions, *b.Name+":"+etag)
+			}
+			return strings.Join(versions, ","), nil
+		})
+	}
+	client, err := newBlobClient(u)
+	if err != nil {
+		return nil, err
+	}
+	return loader.Poll(ctx, interval, func(ctx context.Context) (string, error) {
+		props, err := client.GetProperties(ctx, nil)
+		if err != nil {
+			return "", err
+		}
+		if props.ETag == nil {
+			return "", nil
+		}
+		return string(*props.ETag), nil
+	})
+}
+
+// newBlobClient returns the client of the blob, in which the host of the URL is the storage account
+// and the path is the container followed by the name of the blob.
+func newBlobClient(u *url.URL) (*blob.Client, error) {
+	client, name, err := newContainerClient(u)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("The URL must be in the form of azblob://<account>/<container>/<blob>: %s", u.Redacted())
+	}
+	blobClient := client.NewBlobClient(name)
+	if v := strings.TrimSpace(u.Query().Get("versionId")); v != "" {
+		return blobClient.WithVersionID(v)
+	}
+	return blobClient, nil
+}
+
+// newContainerClient returns the client of the container and the name of the blob, which may be a prefix or a glob pattern.
+func newContainerClient(u *url.URL) (*container.Client, string, error) {
+	account := u.Host
+	containerName, name, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if account == "" || containerName == "" || !ok {
+		return nil, "", fmt.Errorf("The URL must be in the form of azblob://<account>/<container>/<blob>: %s", u.Redacted())
+	}
+
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", account)
+	if endpoint := strings.TrimSpace(u.Query().Get("endpoint")); endpoint != "" {
+		serviceURL = endpoint
+	}
+
+	var client *azblob.Client
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		cred, err := azblob.NewSharedKeyCredential(account, key)
+		if err != nil {
+			return nil, "", err
+		}
+		if client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil); err != nil {
+			return nil, "", err
+		}
+	} else {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if client, err = azblob.NewClient(serviceURL, cred, nil); err != nil {
+			return nil, "", err
+		}
+	}
+	return client.ServiceClient().NewContainerClient(containerName), name, nil
+}
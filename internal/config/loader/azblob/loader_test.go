@@ -0,0 +1,111 @@
+package azblob
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAzurite serves the blobs of the devstoreaccount1 account, like Azurite.
+func fakeAzurite(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/devstoreaccount1/ikesu" && r.URL.Query().Get("comp") == "list" {
+			var blobs string
+			for _, name := range []string{"check.yml", "conf.d/a.yml", "conf.d/b.yaml", "conf.d/README.md", "conf.d/sub/c.yml"} {
+				if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					blobs += fmt.Sprintf(`<Blob><Name>%s</Name><Properties><Etag>0x8D</Etag></Properties></Blob>`, name)
+				}
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults ContainerName="ikesu"><Blobs>%s</Blobs><NextMarker /></EnumerationResults>`, blobs)
+			return
+		}
+		if r.URL.Path != "/devstoreaccount1/ikesu/check.yml" {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>BlobNotFound</Code><Message>The specified blob does not exist.</Message></Error>`)
+			return
+		}
+		body := "check: []\n"
+		if r.URL.Query().Get("versionid") == "v1" {
+			body = "check: [v1]\n"
+		}
+		w.Header().Set("ETag", `"0x8D"`)
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestLoadWithContext(t *testing.T) {
+	// The well-known key of Azurite.
+	t.Setenv("AZURE_STORAGE_KEY", "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==")
+	ts := fakeAzurite(t)
+	defer ts.Close()
+	endpoint := url.QueryEscape(ts.URL + "/devstoreaccount1")
+	load := func(rawURL string) ([]byte, error) {
+		u, _ := url.Parse(rawURL)
+		return (&Loader{}).LoadWithContext(context.Background(), u)
+	}
+
+	buf, err := load("azblob://devstoreaccount1/ikesu/check.yml?endpoint=" + endpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+
+	buf, err = load("azblob://devstoreaccount1/ikesu/check.yml?versionId=v1&endpoint=" + endpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: [v1]\n", string(buf))
+
+	_, err = load("azblob://devstoreaccount1/ikesu/missing.yml?endpoint=" + endpoint)
+	assert.True(t, bloberror.HasCode(err, bloberror.BlobNotFound))
+
+	_, err = load("azblob://devstoreaccount1/check.yml?endpoint=" + endpoint)
+	assert.ErrorContains(t, err, "azblob://<account>/<container>/<blob>")
+}
+
+func TestListWithContext(t *testing.T) {
+	t.Setenv("AZURE_STORAGE_KEY", "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==")
+	ts := fakeAzurite(t)
+	defer ts.Close()
+	list := func(rawURL string) ([]string, error) {
+		u, _ := url.Parse(rawURL + "?endpoint=" + url.QueryEscape(ts.URL+"/devstoreaccount1"))
+		urls, err := (&Loader{}).ListWithContext(context.Background(), u)
+		var paths []string
+		for _, v := range urls {
+			assert.Equal(t, u.RawQuery, v.RawQuery)
+			paths = append(paths, v.Host+v.Path)
+		}
+		return paths, err
+	}
+
+	paths, err := list("azblob://devstoreaccount1/ikesu/check.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devstoreaccount1/ikesu/check.yml"}, paths)
+
+	paths, err = list("azblob://devstoreaccount1/ikesu/conf.d/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devstoreaccount1/ikesu/conf.d/a.yml", "devstoreaccount1/ikesu/conf.d/b.yaml"}, paths)
+
+	paths, err = list("azblob://devstoreaccount1/ikesu/conf.d/*.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devstoreaccount1/ikesu/conf.d/a.yml"}, paths)
+
+	paths, err = list("azblob://devstoreaccount1/ikesu/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devstoreaccount1/ikesu/check.yml"}, paths)
+
+	_, err = list("azblob://devstoreaccount1/ikesu/missing/")
+	assert.EqualError(t, err, "No config blob matches azblob://devstoreaccount1/ikesu/missing/.")
+
+	_, err = list("azblob://devstoreaccount1/ikesu")
+	assert.ErrorContains(t, err, "azblob://<account>/<container>/<blob>")
+
+	u, _ := url.Parse("azblob://devstoreaccount1/ikesu/conf.d/?versionId=v1&endpoint=" + url.QueryEscape(ts.URL+"/devstoreaccount1"))
+	_, err = (&Loader{}).ListWithContext(context.Background(), u)
+	assert.EqualError(t, err, "versionId cannot be specified for several blobs, since it is the version of a single blob: azblob://devstoreaccount1/ikesu/conf.d/")
+}
@@ -0,0 +1,34 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/tukaelu/ikesu/internal/config/loader"
+)
+
+func init() {
+	loader.Register("env", &Loader{})
+}
+
+// Loader loads the configuration from an environment variable, e.g. env://IKESU_CONFIG_YAML
+// It is meant for a small configuration inlined such as in the environment of AWS Lambda.
+type Loader struct{}
+
+func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	name := u.Host
+	if name == "" {
+		return nil, fmt.Errorf("The environment variable is not specified: %s", u.String())
+	}
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("The environment variable %s is not set.", name)
+	}
+	if strings.TrimSpace(v) == "" {
+		return nil, fmt.Errorf("The environment variable %s is empty.", name)
+	}
+	return []byte(v), nil
+}
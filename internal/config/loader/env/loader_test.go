@@ -0,0 +1,28 @@
+package env
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadWithContext(t *testing.T) {
+	load := func(rawURL string) ([]byte, error) {
+		u, _ := url.Parse(rawURL)
+		return (&Loader{}).LoadWithContext(context.Background(), u)
+	}
+
+	t.Setenv("IKESU_CONFIG_YAML", "check:\n  - name: web\n")
+	buf, err := load("env://IKESU_CONFIG_YAML")
+	assert.NoError(t, err)
+	assert.Equal(t, "check:\n  - name: web\n", string(buf))
+
+	_, err = load("env://IKESU_UNDEFINED_CONFIG_YAML")
+	assert.EqualError(t, err, "The environment variable IKESU_UNDEFINED_CONFIG_YAML is not set.")
+
+	t.Setenv("IKESU_EMPTY_CONFIG_YAML", " ")
+	_, err = load("env://IKESU_EMPTY_CONFIG_YAML")
+	assert.EqualError(t, err, "The environment variable IKESU_EMPTY_CONFIG_YAML is empty.")
+}
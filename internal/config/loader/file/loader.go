@@ -5,10 +5,18 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 
 	"github.com/tukaelu/ikesu/internal/config/loader"
 )
 
+// debounce is how long to wait for the events to settle, since an editor may write a file in several steps.
+const debounce = 100 * time.Millisecond
+
 var (
 	ErrNoCheckRules     = fmt.Errorf("No check rules defined.")
 	ErrNoSuchConfigFile = fmt.Errorf("No such config file.")
@@ -19,6 +27,8 @@ func init() {
 	loader.Register("file", &Loader{})
 }
 
+// Loader loads the configuration from a local file.
+// A directory or a glob pattern such as conf.d/*.yml refers to several files, see ListWithContext.
 type Loader struct{}
 
 func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
@@ -40,3 +50,152 @@ func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error
 	}
 	return os.ReadFile(u.Path)
 }
+
+// ListWithContext returns the files matching a glob pattern, or the YAML files (*.yml and *.yaml) directly in a directory, in lexical order.
+func (d *Loader) ListWithContext(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	var paths []string
+	switch fi, err := os.Stat(u.Path); {
+	case isGlob(u.Path):
+		matches, err := filepath.Glob(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && !fi.IsDir() {
+				paths = append(paths, m)
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("No config file matches %s.", u.Path)
+		}
+	case err == nil && fi.IsDir():
+		entries, err := os.ReadDir(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && isYAML(e.Name()) {
+				paths = append(paths, filepath.Join(u.Path, e.Name()))
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("No config file in the directory %s.", u.Path)
+		}
+	default:
+		return []*url.URL{u}, nil
+	}
+
+	urls := make([]*url.URL, 0, len(paths))
+	for _, p := range paths {
+		urls = append(urls, &url.URL{Scheme: u.Scheme, Path: p})
+	}
+	return urls, nil
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func isYAML(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// WatchWithContext notifies when the file is written or created.
+// The directory is watched instead of the file, so that the file replaced by renaming, as many editors do, is also detected.
+// For a directory or a glob pattern, the removal of the files is also notified, since it changes the merged configuration.
+// A change of the file a symbolic link resolves to is also notified, since a ConfigMap mounted in Kubernetes is updated
+// by swapping the ..data symbolic link in the directory, in which no event occurs for the file itself.
+func (d *Loader) WatchWithContext(ctx context.Context, u *url.URL) (<-chan struct{}, error) {
+	path, err := filepath.Abs(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	match := func(name string) bool { return name == path }
+	list := func() []string { return []string{path} }
+	multi := true
+	if fi, err := os.Stat(path); isGlob(path) {
+		match = func(name string) bool {
+			ok, _ := filepath.Match(path, name)
+			return ok
+		}
+		list = func() []string {
+			matches, _ := filepath.Glob(path)
+			return matches
+		}
+	} else if err == nil && fi.IsDir() {
+		dir = path
+		match = func(name string) bool { return filepath.Dir(name) == path && isYAML(name) }
+		list = func() []string {
+			var paths []string
+			entries, _ := os.ReadDir(path)
+			for _, e := range entries {
+				if isYAML(e.Name()) {
+					paths = append(paths, filepath.Join(path, e.Name()))
+				}
+			}
+			return paths
+		}
+	} else {
+		multi = false
+	}
+	resolved := resolveSymlinks(list())
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		defer w.Close()
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				changed := ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create) || (multi && (ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)))
+				if changed && match(filepath.Clean(ev.Name)) {
+					timer.Reset(debounce)
+				}
+				// The other entries of the directory, such as the ..data symbolic link, may change where the files resolve to.
+				if r := resolveSymlinks(list()); r != resolved {
+					resolved = r
+					timer.Reset(debounce)
+				}
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			case <-timer.C:
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// resolveSymlinks returns where the files resolve to through the symbolic links, in which an unresolvable file is empty.
+func resolveSymlinks(paths []string) string {
+	resolved := make([]string, 0, len(paths))
+	for _, p := range paths {
+		r, _ := filepath.EvalSymlinks(p)
+		resolved = append(resolved, p+"="+r)
+	}
+	return strings.Join(resolved, "\n")
+}
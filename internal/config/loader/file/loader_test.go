@@ -0,0 +1,143 @@
+package file
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchWithContext(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "check.yml")
+	assert.NoError(t, os.WriteFile(path, []byte("check: []\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := (&Loader{}).WatchWithContext(ctx, &url.URL{Path: path})
+	assert.NoError(t, err)
+
+	// Changes of the other files in the directory are ignored.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "other.yml"), []byte("check: []\n"), 0644))
+	select {
+	case <-ch:
+		t.Fatal("notified for the other file")
+	case <-time.After(3 * debounce):
+	}
+
+	// A file replaced by renaming is detected as well as a file written in place.
+	tmp := filepath.Join(dir, "check.yml.tmp")
+	assert.NoError(t, os.WriteFile(tmp, []byte("check:\n  - name: web\n"), 0644))
+	assert.NoError(t, os.Rename(tmp, path))
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no notification for the changed file")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestListWithContext(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.yml", "a.yaml", "c.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("check: []\n"), 0644))
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "sub.yml"), 0755))
+	paths := func(urls []*url.URL) []string {
+		var p []string
+		for _, u := range urls {
+			p = append(p, u.Path)
+		}
+		return p
+	}
+
+	urls, err := (&Loader{}).ListWithContext(context.Background(), &url.URL{Path: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yml")}, paths(urls))
+
+	urls, err = (&Loader{}).ListWithContext(context.Background(), &url.URL{Path: filepath.Join(dir, "*.yml")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "b.yml")}, paths(urls))
+
+	urls, err = (&Loader{}).ListWithContext(context.Background(), &url.URL{Path: filepath.Join(dir, "c.txt")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "c.txt")}, paths(urls))
+
+	_, err = (&Loader{}).ListWithContext(context.Background(), &url.URL{Path: filepath.Join(dir, "*.json")})
+	assert.Error(t, err)
+
+	_, err = (&Loader{}).ListWithContext(context.Background(), &url.URL{Path: filepath.Join(dir, "sub.yml")})
+	assert.Error(t, err)
+}
+
+func TestWatchWithContextDirectory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "team-a.yml")
+	assert.NoError(t, os.WriteFile(path, []byte("check: []\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := (&Loader{}).WatchWithContext(ctx, &url.URL{Path: dir})
+	assert.NoError(t, err)
+
+	// The files other than YAML are ignored.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("rules\n"), 0644))
+	select {
+	case <-ch:
+		t.Fatal("notified for the file other than YAML")
+	case <-time.After(3 * debounce):
+	}
+
+	assert.NoError(t, os.Remove(path))
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no notification for the removed file")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchWithContextSymlinkSwap(t *testing.T) {
+	// A ConfigMap in Kubernetes is mounted as check.yml -> ..data/check.yml, and updated by replacing ..data with a new directory.
+	dir := t.TempDir()
+	writeData := func(name, content string) {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, name), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name, "check.yml"), []byte(content), 0644))
+	}
+	writeData("..2024_01_01", "check: []\n")
+	assert.NoError(t, os.Symlink("..2024_01_01", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "check.yml"), filepath.Join(dir, "check.yml")))
+
+	for _, target := range []string{filepath.Join(dir, "check.yml"), dir} {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := (&Loader{}).WatchWithContext(ctx, &url.URL{Path: target})
+		assert.NoError(t, err)
+
+		next := "..2024_01_02"
+		if target == dir {
+			next = "..2024_01_03"
+		}
+		writeData(next, "check:\n  - name: web\n")
+		assert.NoError(t, os.Symlink(next, filepath.Join(dir, "..data_tmp")))
+		assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("no notification for the swapped symbolic link of %s", target)
+		}
+
+		cancel()
+		for range ch {
+		}
+	}
+}
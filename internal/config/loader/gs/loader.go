@@ -0,0 +1,186 @@
+package gs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"github.com/tukaelu/ikesu/internal/config/loader"
+)
+
+func init() {
+	loader.Register("gs", &Loader{})
+}
+
+// Loader loads the configuration from an object of Google Cloud Storage.
+// e.g. gs://bucket/object
+//
+// It is authenticated with the Application Default Credentials, and accepts the query parameters below.
+//
+//	generation    the generation of the object.
+//	endpoint      the endpoint of the emulator such as fake-gcs-server, e.g. http://localhost:4443. It is accessed without authentication.
+//	pollInterval  the interval to check whether the object has been updated in the serve mode.
+//
+// An object name ending with a slash or a glob pattern refers to several objects, see ListWithContext.
+type Loader struct{}
+
+func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	client, err := newClient(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	obj, err := objectHandle(client, u)
+	if err != nil {
+		return nil, err
+	}
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read gs://%s/%s: %w", obj.BucketName(), obj.ObjectName(), err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// ListWithContext returns the YAML objects (*.yml and *.yaml) under a prefix ending with a slash, e.g. gs://bucket/conf.d/,
+// or the objects matching a glob pattern of path.Match, e.g. gs://bucket/conf.d/*.yml, in lexical order.
+func (d *Loader) ListWithContext(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	if !loader.IsMultiObject(objectName(u)) {
+		return []*url.URL{u}, nil
+	}
+	if strings.TrimSpace(u.Query().Get("generation")) != "" {
+		return nil, fmt.Errorf("generation cannot be specified for several objects, since it is the generation of a single object: gs://%s/%s", u.Host, objectName(u))
+	}
+	client, err := newClient(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	objects, err := listObjects(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("No config object matches gs://%s/%s.", u.Host, objectName(u))
+	}
+	urls := make([]*url.URL, 0, len(objects))
+	for _, obj := range objects {
+		v := *u
+		v.Path = "/" + obj.Name
+		urls = append(urls, &v)
+	}
+	return urls, nil
+}
+
+func listObjects(ctx context.Context, client *storage.Client, u *url.URL) ([]*storage.ObjectAttrs, error) {
+	prefix, match := loader.ObjectMatcher(objectName(u))
+	var objects []*storage.ObjectAttrs
+	it := client.Bucket(u.Host).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list gs://%s/%s: %w", u.Host, prefix, err)
+		}
+		if match(attrs.Name) {
+			objects = append(objects, attrs)
+		}
+	}
+	slices.SortFunc(objects, func(a, b *storage.ObjectAttrs) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return objects, nil
+}
+
+// WatchWithContext polls the generation and metageneration of the object, and notifies when either of them changes.
+// For several objects, the addition and the removal of the objects are also notified.
+func (d *Loader) WatchWithContext(ctx context.Context, u *url.URL) (<-chan struct{}, error) {
+	interval, err := loader.PollInterval(u)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newClient(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	poll := func(ctx context.Context) (string, error) {
+		objects, err := listObjects(ctx, client, u)
+		if err != nil {
+			return "", err
+		}
+		var versions []string
+		for _, attrs := range objects {
+			versions = append(versions, fmt.Sprintf("%s:%d/%d", attrs.Name, attrs.Generation, attrs.Metageneration))
+		}
+		return strings.Join(versions, ","), nil
+	}
+	if !loader.IsMultiObject(objectName(u)) {
+		obj, err := objectHandle(client, u)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		poll = func(ctx context.Context) (string, error) {
+			attrs, err := obj.Attrs(ctx)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d/%d", attrs.Generation, attrs.Metageneration), nil
+		}
+	}
+	ch, err := loader.Poll(ctx, interval, poll)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		client.Close()
+	}()
+	return ch, nil
+}
+
+func newClient(ctx context.Context, u *url.URL) (*storage.Client, error) {
+	var opts []option.ClientOption
+	if endpoint := strings.TrimSpace(u.Query().Get("endpoint")); endpoint != "" {
+		e, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid endpoint: %w", err)
+		}
+		if e.Path == "" || e.Path == "/" {
+			e.Path = "/storage/v1/"
+		}
+		// The emulators serve the objects with the JSON API rather than the XML API.
+		opts = append(opts, option.WithEndpoint(e.String()), option.WithoutAuthentication(), storage.WithJSONReads())
+	}
+	return storage.NewClient(ctx, opts...)
+}
+
+func objectHandle(client *storage.Client, u *url.URL) (*storage.ObjectHandle, error) {
+	obj := client.Bucket(u.Host).Object(objectName(u))
+	if gen := strings.TrimSpace(u.Query().Get("generation")); gen != "" {
+		g, err := strconv.ParseInt(gen, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid generation: %w", err)
+		}
+		obj = obj.Generation(g)
+	}
+	return obj, nil
+}
+
+// objectName returns the name of the object, in which the leading slash of the path is trimmed.
+func objectName(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
@@ -0,0 +1,109 @@
+package gs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGCS serves the objects with the JSON API, like fake-gcs-server.
+func fakeGCS(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/storage/v1/b/ikesu/o" {
+			var items []string
+			for _, name := range []string{"check.yml", "conf.d/a.yml", "conf.d/b.yaml", "conf.d/README.md", "conf.d/sub/c.yml"} {
+				if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					items = append(items, fmt.Sprintf(`{"bucket":"ikesu","name":%q,"generation":"1","metageneration":"1"}`, name))
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"kind":"storage#objects","items":[%s]}`, strings.Join(items, ","))
+			return
+		}
+		if r.URL.Path != "/storage/v1/b/ikesu/o/check.yml" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"message":"Not Found"}}`)
+			return
+		}
+		if r.URL.Query().Get("alt") != "media" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"bucket":"ikesu","name":"check.yml","generation":"2","metageneration":"1"}`)
+			return
+		}
+		body := "check: []\n"
+		if r.URL.Query().Get("generation") == "1" {
+			body = "check: [v1]\n"
+		}
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestLoadWithContext(t *testing.T) {
+	ts := fakeGCS(t)
+	defer ts.Close()
+	load := func(rawURL string) ([]byte, error) {
+		u, _ := url.Parse(rawURL)
+		return (&Loader{}).LoadWithContext(context.Background(), u)
+	}
+
+	buf, err := load("gs://ikesu/check.yml?endpoint=" + url.QueryEscape(ts.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+
+	buf, err = load("gs://ikesu/check.yml?generation=1&endpoint=" + url.QueryEscape(ts.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "check: [v1]\n", string(buf))
+
+	_, err = load("gs://ikesu/missing.yml?endpoint=" + url.QueryEscape(ts.URL))
+	assert.True(t, errors.Is(err, storage.ErrObjectNotExist))
+
+	_, err = load("gs://ikesu/check.yml?generation=latest&endpoint=" + url.QueryEscape(ts.URL))
+	assert.ErrorContains(t, err, "Invalid generation")
+}
+
+func TestListWithContext(t *testing.T) {
+	ts := fakeGCS(t)
+	defer ts.Close()
+	list := func(rawURL string) ([]string, error) {
+		u, _ := url.Parse(rawURL + "?endpoint=" + url.QueryEscape(ts.URL))
+		urls, err := (&Loader{}).ListWithContext(context.Background(), u)
+		var paths []string
+		for _, v := range urls {
+			assert.Equal(t, u.RawQuery, v.RawQuery)
+			paths = append(paths, v.Host+v.Path)
+		}
+		return paths, err
+	}
+
+	paths, err := list("gs://ikesu/check.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ikesu/check.yml"}, paths)
+
+	paths, err = list("gs://ikesu/conf.d/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ikesu/conf.d/a.yml", "ikesu/conf.d/b.yaml"}, paths)
+
+	paths, err = list("gs://ikesu/conf.d/*.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ikesu/conf.d/a.yml"}, paths)
+
+	paths, err = list("gs://ikesu/conf.d/*/*.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ikesu/conf.d/sub/c.yml"}, paths)
+
+	_, err = list("gs://ikesu/missing/")
+	assert.EqualError(t, err, "No config object matches gs://ikesu/missing/.")
+
+	u, _ := url.Parse("gs://ikesu/conf.d/?generation=1&endpoint=" + url.QueryEscape(ts.URL))
+	_, err = (&Loader{}).ListWithContext(context.Background(), u)
+	assert.EqualError(t, err, "generation cannot be specified for several objects, since it is the generation of a single object: gs://ikesu/conf.d/")
+}
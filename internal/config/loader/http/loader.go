@@ -0,0 +1,302 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tukaelu/ikesu/internal/config/loader"
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultPollInterval = time.Minute
+
+	// headerEnvPrefix is the prefix of the environment variables to add the request headers, e.g. IKESU_HTTP_HEADER_X_API_KEY sets X-Api-Key.
+	headerEnvPrefix = "IKESU_HTTP_HEADER_"
+)
+
+var (
+	ErrEmptyConfig       = fmt.Errorf("The config returned from the server is empty.")
+	ErrNoCredentialsHost = fmt.Errorf("IKESU_HTTP_CREDENTIALS_HOST is not set. Specify the hosts to send IKESU_HTTP_BEARER_TOKEN and IKESU_HTTP_HEADER_* to.")
+)
+
+func init() {
+	l := &Loader{}
+	loader.Register("http", l)
+	loader.Register("https", l)
+}
+
+// Loader loads the configuration over HTTP(S). It is configured by the environment variables below.
+//
+//	IKESU_HTTP_BEARER_TOKEN                sent as the bearer token in the Authorization header.
+//	IKESU_HTTP_HEADER_<NAME>               sent as a header, in which the underscores of the name are replaced with hyphens.
+//	IKESU_HTTP_CREDENTIALS_HOST            the comma-separated hosts to send the bearer token and the headers to, required if either is set.
+//	IKESU_HTTP_ALLOW_INSECURE_CREDENTIALS  allows sending the bearer token and the headers over plain http if true.
+//	IKESU_HTTP_TIMEOUT                     the timeout of a request (default: 30s).
+//	IKESU_HTTP_CACHE_DIR                   the directory to cache the configuration (default: the user cache directory).
+//	IKESU_HTTP_POLL_INTERVAL               the interval to check whether the configuration has been updated (default: 1m).
+//
+// The response is cached with its ETag and Last-Modified, which are sent in the conditional request next time.
+// If the server is unreachable or returns a server error, the cached copy is used.
+type Loader struct{}
+
+// cacheMeta is stored next to the cached configuration.
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	cache := newCache(u)
+	cached, meta, cacheErr := cache.read()
+
+	req, err := newRequest(ctx, nethttp.MethodGet, u)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr == nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fallback(cached, cacheErr, err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == nethttp.StatusNotModified && cacheErr == nil:
+		return cached, nil
+	case res.StatusCode >= 500:
+		return fallback(cached, cacheErr, fmt.Errorf("The server returned %s for %s.", res.Status, u.Redacted()))
+	case res.StatusCode != nethttp.StatusOK:
+		return nil, fmt.Errorf("The server returned %s for %s.", res.Status, u.Redacted())
+	}
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fallback(cached, cacheErr, err)
+	}
+	if len(buf) == 0 {
+		return nil, ErrEmptyConfig
+	}
+	// A failure of caching does not prevent the configuration from being used.
+	_ = cache.write(buf, &cacheMeta{
+		URL:          u.Redacted(),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	})
+	return buf, nil
+}
+
+// WatchWithContext polls the ETag and Last-Modified of the configuration with HEAD requests, and notifies when either of them changes.
+func (d *Loader) WatchWithContext(ctx context.Context, u *url.URL) (<-chan struct{}, error) {
+	interval, err := durationFromEnv("IKESU_HTTP_POLL_INTERVAL", defaultPollInterval)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	return loader.Poll(ctx, interval, func(ctx context.Context) (string, error) {
+		req, err := newRequest(ctx, nethttp.MethodHead, u)
+		if err != nil {
+			return "", err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		res.Body.Close()
+		if res.StatusCode != nethttp.StatusOK {
+			return "", fmt.Errorf("The server returned %s for %s.", res.Status, u.Redacted())
+		}
+		return res.Header.Get("ETag") + "/" + res.Header.Get("Last-Modified"), nil
+	})
+}
+
+// fallback returns the cached configuration in place of the failed request, or the error if there is no cache.
+func fallback(cached []byte, cacheErr, err error) ([]byte, error) {
+	if cacheErr != nil {
+		return nil, err
+	}
+	return cached, nil
+}
+
+func newClient() (*nethttp.Client, error) {
+	timeout, err := durationFromEnv("IKESU_HTTP_TIMEOUT", defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &nethttp.Client{
+		Timeout: timeout,
+		// The credentials are removed when redirected to a host which they are not sent to.
+		CheckRedirect: func(req *nethttp.Request, via []*nethttp.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			header, err := credentials(req.URL)
+			if err != nil {
+				return err
+			}
+			if header == nil {
+				for name := range credentialHeaders() {
+					req.Header.Del(name)
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+func newRequest(ctx context.Context, method string, u *url.URL) (*nethttp.Request, error) {
+	req, err := nethttp.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	header, err := credentials(u)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return req, nil
+}
+
+// credentials returns the bearer token and the headers to be sent to the URL.
+// They are sent only to the hosts in IKESU_HTTP_CREDENTIALS_HOST, so that they do not leak to the other servers,
+// and not over plain http unless IKESU_HTTP_ALLOW_INSECURE_CREDENTIALS is true.
+func credentials(u *url.URL) (nethttp.Header, error) {
+	header := credentialHeaders()
+	if len(header) == 0 {
+		return nil, nil
+	}
+
+	hosts := strings.TrimSpace(os.Getenv("IKESU_HTTP_CREDENTIALS_HOST"))
+	if hosts == "" {
+		return nil, ErrNoCredentialsHost
+	}
+	if !matchHost(u, strings.Split(hosts, ",")) {
+		return nil, nil
+	}
+	if u.Scheme != "https" {
+		insecure, _ := strconv.ParseBool(os.Getenv("IKESU_HTTP_ALLOW_INSECURE_CREDENTIALS"))
+		if !insecure {
+			return nil, fmt.Errorf("The credentials are not sent over plain http to %s. Use https, or set IKESU_HTTP_ALLOW_INSECURE_CREDENTIALS=true to allow it.", u.Redacted())
+		}
+	}
+	return header, nil
+}
+
+// credentialHeaders returns the bearer token and the headers specified by the environment variables.
+func credentialHeaders() nethttp.Header {
+	header := make(nethttp.Header)
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if h, ok := strings.CutPrefix(name, headerEnvPrefix); ok && h != "" {
+			header.Set(strings.ReplaceAll(h, "_", "-"), value)
+		}
+	}
+	if token := os.Getenv("IKESU_HTTP_BEARER_TOKEN"); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header
+}
+
+// matchHost returns whether the host of the URL is one of the hosts. A host without a port matches any port.
+func matchHost(u *url.URL, hosts []string) bool {
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if strings.EqualFold(h, u.Host) || strings.EqualFold(h, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %w", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive: %s", name, v)
+	}
+	return d, nil
+}
+
+// cache is the locally cached copy of the configuration at a URL.
+type cache struct {
+	path string
+}
+
+func newCache(u *url.URL) *cache {
+	dir := os.Getenv("IKESU_HTTP_CACHE_DIR")
+	if dir == "" {
+		if d, err := os.UserCacheDir(); err == nil {
+			dir = filepath.Join(d, "ikesu")
+		} else {
+			// e.g. AWS Lambda, where HOME is not set.
+			dir = filepath.Join(os.TempDir(), "ikesu")
+		}
+	}
+	sum := sha256.Sum256([]byte(u.String()))
+	return &cache{path: filepath.Join(dir, hex.EncodeToString(sum[:]))}
+}
+
+func (c *cache) read() ([]byte, *cacheMeta, error) {
+	buf, err := os.ReadFile(c.path + ".yml")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(buf) == 0 {
+		return nil, nil, errors.New("The cached config is empty.")
+	}
+	meta := &cacheMeta{}
+	if b, err := os.ReadFile(c.path + ".json"); err == nil {
+		_ = json.Unmarshal(b, meta)
+	}
+	return buf, meta, nil
+}
+
+func (c *cache) write(buf []byte, meta *cacheMeta) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.path+".yml", buf, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path+".json", b, 0600)
+}
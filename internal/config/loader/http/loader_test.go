@@ -0,0 +1,184 @@
+package http
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// configServer serves a configuration with an ETag, and records the requests.
+type configServer struct {
+	mu       sync.Mutex
+	body     string
+	etag     string
+	requests []*nethttp.Request
+}
+
+func (s *configServer) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(nethttp.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(nethttp.StatusNotModified)
+		return
+	}
+	if r.Method == nethttp.MethodGet {
+		_, _ = w.Write([]byte(s.body))
+	}
+}
+
+func (s *configServer) update(body, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag = body, etag
+}
+
+func (s *configServer) lastRequest() *nethttp.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func TestLoadWithContext(t *testing.T) {
+	t.Setenv("IKESU_HTTP_CACHE_DIR", t.TempDir())
+	t.Setenv("IKESU_HTTP_BEARER_TOKEN", "secret")
+	t.Setenv("IKESU_HTTP_CREDENTIALS_HOST", "127.0.0.1")
+	t.Setenv("IKESU_HTTP_ALLOW_INSECURE_CREDENTIALS", "true")
+	t.Setenv("IKESU_HTTP_HEADER_X_CONFIG_ENV", "production")
+
+	cs := &configServer{body: "check: []\n", etag: `"v1"`}
+	ts := httptest.NewServer(cs)
+	u, _ := url.Parse(ts.URL + "/check.yml")
+	l := &Loader{}
+
+	buf, err := l.LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+	assert.Equal(t, "production", cs.lastRequest().Header.Get("X-Config-Env"))
+	assert.Empty(t, cs.lastRequest().Header.Get("If-None-Match"))
+
+	// The cached copy is used if it has not been modified.
+	buf, err = l.LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+	assert.Equal(t, `"v1"`, cs.lastRequest().Header.Get("If-None-Match"))
+
+	cs.update("check:\n  - name: web\n", `"v2"`)
+	buf, err = l.LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "check:\n  - name: web\n", string(buf))
+
+	// The cached copy is used if the server is unreachable.
+	ts.Close()
+	buf, err = l.LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "check:\n  - name: web\n", string(buf))
+
+	// Without a cache, the failure is returned.
+	other, _ := url.Parse(ts.URL + "/other.yml")
+	_, err = l.LoadWithContext(context.Background(), other)
+	assert.Error(t, err)
+}
+
+func TestLoadWithContextClientError(t *testing.T) {
+	t.Setenv("IKESU_HTTP_CACHE_DIR", t.TempDir())
+
+	ts := httptest.NewServer(&configServer{body: "check: []\n", etag: `"v1"`})
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/check.yml")
+
+	_, err := (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
+
+func TestLoadWithContextCredentials(t *testing.T) {
+	t.Setenv("IKESU_HTTP_CACHE_DIR", t.TempDir())
+	t.Setenv("IKESU_HTTP_BEARER_TOKEN", "secret")
+	t.Setenv("IKESU_HTTP_HEADER_X_API_KEY", "key")
+
+	cs := &configServer{body: "check: []\n", etag: `"v1"`}
+	ts := httptest.NewServer(cs)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/check.yml")
+
+	// The credentials are not sent unless the hosts are specified.
+	_, err := (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.ErrorIs(t, err, ErrNoCredentialsHost)
+	assert.Empty(t, cs.requests)
+
+	// They are not sent over plain http unless it is allowed.
+	t.Setenv("IKESU_HTTP_CREDENTIALS_HOST", "config.example.com, 127.0.0.1")
+	_, err = (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.ErrorContains(t, err, "The credentials are not sent over plain http")
+	assert.Empty(t, cs.requests)
+
+	t.Setenv("IKESU_HTTP_ALLOW_INSECURE_CREDENTIALS", "true")
+	_, err = (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "key", cs.lastRequest().Header.Get("X-Api-Key"))
+
+	// They are not sent to the other hosts.
+	other, _ := url.Parse("http://localhost:" + u.Port() + "/check.yml")
+	_, err = (&Loader{}).LoadWithContext(context.Background(), other)
+	assert.ErrorContains(t, err, "401 Unauthorized")
+	assert.Empty(t, cs.lastRequest().Header.Get("Authorization"))
+	assert.Empty(t, cs.lastRequest().Header.Get("X-Api-Key"))
+
+	// They are removed when redirected to the other hosts.
+	redirect := httptest.NewServer(nethttp.RedirectHandler(other.String(), nethttp.StatusFound))
+	defer redirect.Close()
+	from, _ := url.Parse(redirect.URL + "/check.yml")
+	_, err = (&Loader{}).LoadWithContext(context.Background(), from)
+	assert.ErrorContains(t, err, "401 Unauthorized")
+	assert.Empty(t, cs.lastRequest().Header.Get("X-Api-Key"))
+}
+
+func TestLoadWithContextTimeout(t *testing.T) {
+	t.Setenv("IKESU_HTTP_CACHE_DIR", t.TempDir())
+	t.Setenv("IKESU_HTTP_TIMEOUT", "50ms")
+
+	ts := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/check.yml")
+
+	_, err := (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.ErrorContains(t, err, "Timeout")
+}
+
+func TestWatchWithContext(t *testing.T) {
+	t.Setenv("IKESU_HTTP_BEARER_TOKEN", "secret")
+	t.Setenv("IKESU_HTTP_CREDENTIALS_HOST", "127.0.0.1")
+	t.Setenv("IKESU_HTTP_ALLOW_INSECURE_CREDENTIALS", "true")
+	t.Setenv("IKESU_HTTP_POLL_INTERVAL", "10ms")
+
+	cs := &configServer{body: "check: []\n", etag: `"v1"`}
+	ts := httptest.NewServer(cs)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/check.yml")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := (&Loader{}).WatchWithContext(ctx, u)
+	assert.NoError(t, err)
+
+	cs.update("check:\n  - name: web\n", `"v2"`)
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no notification for the updated config")
+	}
+	assert.Equal(t, nethttp.MethodHead, cs.lastRequest().Method)
+}
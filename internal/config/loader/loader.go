@@ -2,9 +2,13 @@ package loader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
+	"path"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -12,10 +16,30 @@ var (
 	loaders = make(map[string]Loader)
 )
 
+// DefaultPollInterval is the interval to check whether the configuration in a remote storage has been updated.
+const DefaultPollInterval = time.Minute
+
+var ErrNotWatchable = errors.New("The loader does not support watching for changes.")
+
 type Loader interface {
 	LoadWithContext(context.Context, *url.URL) ([]byte, error)
 }
 
+// Watcher is optionally implemented by a Loader that can detect changes of the configuration.
+type Watcher interface {
+	// WatchWithContext returns a channel that receives a value whenever the configuration may have changed.
+	// The channel is closed when the context is canceled.
+	WatchWithContext(context.Context, *url.URL) (<-chan struct{}, error)
+}
+
+// Lister is optionally implemented by a Loader that can refer to several configuration files with a URL,
+// such as a directory, a glob pattern or a prefix of the objects.
+type Lister interface {
+	// ListWithContext returns the URLs of the configuration files that the URL refers to, in the order to be merged.
+	// A URL of a single file is returned as it is.
+	ListWithContext(context.Context, *url.URL) ([]*url.URL, error)
+}
+
 // Register a loader.
 func Register(name string, loader Loader) {
 	mu.Lock()
@@ -31,10 +55,7 @@ func Register(name string, loader Loader) {
 
 // LoadWithContext returns the contents of the file loaded from the loader as a byte array.
 func LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
-	name := u.Scheme
-	if name == "" {
-		name = "file"
-	}
+	name := schemeOf(u)
 	loader, ok := getRegisteredLoader(name)
 	if !ok {
 		return nil, fmt.Errorf("There is no loader registered for the '%s' schema.", name)
@@ -42,7 +63,125 @@ func LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
 	return loader.LoadWithContext(ctx, u)
 }
 
+// ListWithContext returns the URLs of the configuration files that the URL refers to.
+// If the loader does not implement Lister, the URL is returned as it is.
+func ListWithContext(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	name := schemeOf(u)
+	l, ok := getRegisteredLoader(name)
+	if !ok {
+		return nil, fmt.Errorf("There is no loader registered for the '%s' schema.", name)
+	}
+	lister, ok := l.(Lister)
+	if !ok {
+		return []*url.URL{u}, nil
+	}
+	return lister.ListWithContext(ctx, u)
+}
+
+// WatchWithContext returns a channel notified when the configuration may have changed.
+// If the loader does not implement Watcher, ErrNotWatchable is returned.
+func WatchWithContext(ctx context.Context, u *url.URL) (<-chan struct{}, error) {
+	name := schemeOf(u)
+	l, ok := getRegisteredLoader(name)
+	if !ok {
+		return nil, fmt.Errorf("There is no loader registered for the '%s' schema.", name)
+	}
+	w, ok := l.(Watcher)
+	if !ok {
+		return nil, ErrNotWatchable
+	}
+	return w.WatchWithContext(ctx, u)
+}
+
+// Poll calls version at the interval and notifies when it returns a value different from the previous one, until the context is canceled.
+// It is meant for the loaders of remote storages, in which version is such as an ETag.
+// A failure of the first call is returned, and later failures are ignored so that watching continues over temporary failures.
+func Poll(ctx context.Context, interval time.Duration, version func(context.Context) (string, error)) (<-chan struct{}, error) {
+	current, err := version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			v, err := version(ctx)
+			if err != nil || v == current {
+				continue
+			}
+			current = v
+			notify(ch)
+		}
+	}()
+	return ch, nil
+}
+
+// PollInterval returns the interval given by the pollInterval query, e.g. s3://bucket/key?pollInterval=30s,
+// or DefaultPollInterval if it is not given.
+func PollInterval(u *url.URL) (time.Duration, error) {
+	pi := strings.TrimSpace(u.Query().Get("pollInterval"))
+	if pi == "" {
+		return DefaultPollInterval, nil
+	}
+	d, err := time.ParseDuration(pi)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("pollInterval must be positive: %s", pi)
+	}
+	return d, nil
+}
+
+// notify sends to the channel without blocking. Since it only tells that a change may have occurred, pending notifications are coalesced.
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// schemeOf returns the name of the loader for the URL. A URL without a scheme is a local file, except "-" for the standard input.
+func schemeOf(u *url.URL) string {
+	switch {
+	case u.Scheme != "":
+		return u.Scheme
+	case u.Path == "-":
+		return "stdin"
+	default:
+		return "file"
+	}
+}
+
 func getRegisteredLoader(name string) (Loader, bool) {
 	loader, ok := loaders[name]
 	return loader, ok
 }
+
+// IsMultiObject returns whether the key of an object storage refers to several objects,
+// that is, it is empty, ends with a slash or is a glob pattern.
+func IsMultiObject(key string) bool {
+	return key == "" || strings.HasSuffix(key, "/") || strings.ContainsAny(key, "*?[")
+}
+
+// ObjectMatcher returns the prefix to list the objects with and the function reporting whether a listed key matches.
+// A prefix matches the YAML objects (*.yml and *.yaml) directly under it, and a glob pattern is matched with path.Match.
+func ObjectMatcher(key string) (string, func(string) bool) {
+	if i := strings.IndexAny(key, "*?["); i >= 0 {
+		return key[:i], func(k string) bool {
+			ok, _ := path.Match(key, k)
+			return ok
+		}
+	}
+	return key, func(k string) bool {
+		ext := path.Ext(k)
+		return !strings.Contains(strings.TrimPrefix(k, key), "/") && (ext == ".yml" || ext == ".yaml")
+	}
+}
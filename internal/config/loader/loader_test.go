@@ -0,0 +1,107 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticLoader struct{}
+
+func (l *staticLoader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	return []byte("check: []"), nil
+}
+
+// The loaders are registered once, since the registry is global and a duplicate name panics when the tests run again.
+func init() {
+	Register("static", &staticLoader{})
+	Register("single", &staticLoader{})
+}
+
+func TestWatchWithContextNotWatchable(t *testing.T) {
+	_, err := WatchWithContext(context.Background(), &url.URL{Scheme: "static", Path: "/check.yml"})
+	assert.ErrorIs(t, err, ErrNotWatchable)
+
+	_, err = WatchWithContext(context.Background(), &url.URL{Scheme: "unregistered", Path: "/check.yml"})
+	assert.EqualError(t, err, "There is no loader registered for the 'unregistered' schema.")
+}
+
+func TestListWithContextNotListable(t *testing.T) {
+	u := &url.URL{Scheme: "single", Path: "/check.yml"}
+	urls, err := ListWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, []*url.URL{u}, urls)
+}
+
+func TestPoll(t *testing.T) {
+	var mu sync.Mutex
+	versions := []string{"v1", "v1", "", "v2", "v2"}
+	calls := 0
+	version := func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		v := versions[min(calls, len(versions)-1)]
+		calls++
+		if v == "" {
+			// A temporary failure does not stop polling.
+			return "", errors.New("temporary failure")
+		}
+		return v, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := Poll(ctx, 10*time.Millisecond, version)
+	assert.NoError(t, err)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no notification for the changed version")
+	}
+	cancel()
+	for range ch {
+	}
+	mu.Lock()
+	assert.GreaterOrEqual(t, calls, 4)
+	mu.Unlock()
+}
+
+func TestPollFailsFirst(t *testing.T) {
+	_, err := Poll(context.Background(), time.Second, func(ctx context.Context) (string, error) {
+		return "", errors.New("access denied")
+	})
+	assert.EqualError(t, err, "access denied")
+}
+
+func TestPollInterval(t *testing.T) {
+	d, err := PollInterval(&url.URL{Scheme: "s3", Host: "bucket", Path: "/check.yml"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPollInterval, d)
+
+	d, err = PollInterval(&url.URL{Scheme: "s3", Host: "bucket", Path: "/check.yml", RawQuery: "pollInterval=30s"})
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, d)
+
+	_, err = PollInterval(&url.URL{Scheme: "s3", Host: "bucket", Path: "/check.yml", RawQuery: "pollInterval=0s"})
+	assert.Error(t, err)
+}
+
+func TestSchemeOf(t *testing.T) {
+	for raw, want := range map[string]string{
+		"check.yml":               "file",
+		"/etc/ikesu/check.yml":    "file",
+		"-":                       "stdin",
+		"./-":                     "file",
+		"env://IKESU_CONFIG_YAML": "env",
+		"s3://bucket/check.yml":   "s3",
+	} {
+		u, err := url.Parse(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, want, schemeOf(u), raw)
+	}
+}
@@ -2,62 +2,247 @@ package s3
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 
 	"github.com/tukaelu/ikesu/internal/config/loader"
+	"github.com/tukaelu/ikesu/internal/config/loader/awsconfig"
 )
 
-const defaultRegion = "ap-northeast-1"
+var (
+	ErrNoSuchObject = fmt.Errorf("No such object in the bucket.")
+	ErrAccessDenied = fmt.Errorf("Access to the object is denied.")
+)
+
+// ObjectError is a failure to access an object. It matches ErrNoSuchObject or ErrAccessDenied with errors.Is,
+// as well as the error returned from the SDK.
+type ObjectError struct {
+	Bucket string
+	Key    string
+	kind   error
+	err    error
+}
+
+func (e *ObjectError) Error() string {
+	return fmt.Sprintf("%s s3://%s/%s: %s", e.kind, e.Bucket, e.Key, e.err)
+}
+
+func (e *ObjectError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
 
 func init() {
 	loader.Register("s3", &Loader{})
 }
 
+// Loader loads the configuration from an object of Amazon S3.
+// e.g. s3://bucket/key?regionHint=ap-northeast-1
+//
+// In addition to the query parameters of awsconfig.Load, it accepts the query parameters below.
+//
+//	versionId     the version of the object.
+//	pathStyle     whether to use the path-style addressing, which is required by MinIO and LocalStack.
+//	pollInterval  the interval to check whether the object has been updated in the serve mode.
+//
+// If neither regionHint nor endpoint is specified, the region of the bucket is looked up.
+// A key ending with a slash or a glob pattern refers to several objects, see ListWithContext.
 type Loader struct{}
 
 func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
-	client, err := newS3Client(ctx, u.Host, resolveRegion(u))
+	client, err := newClient(ctx, u)
 	if err != nil {
 		return nil, err
 	}
-	return fetchFromBucket(ctx, client, u.Host, u.Path)
+	return fetchFromBucket(ctx, client, u)
 }
 
-func resolveRegion(u *url.URL) string {
-	// e.g. s3://bucket/key?regionHint=ap-northeast-1
-	if rh := strings.TrimSpace(u.Query().Get("regionHint")); rh != "" {
-		return rh
+// ListWithContext returns the YAML objects (*.yml and *.yaml) under a prefix ending with a slash, e.g. s3://bucket/conf.d/,
+// or the objects matching a glob pattern of path.Match, e.g. s3://bucket/conf.d/*.yml, in lexical order.
+func (d *Loader) ListWithContext(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	if !loader.IsMultiObject(objectKey(u)) {
+		return []*url.URL{u}, nil
+	}
+	if versionID(u) != "" {
+		return nil, fmt.Errorf("versionId cannot be specified for several objects, since it is the version of a single object: s3://%s/%s", u.Host, objectKey(u))
+	}
+	client, err := newClient(ctx, u)
+	if err != nil {
+		return nil, err
 	}
-	return defaultRegion
+	objects, err := listObjects(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("No config object matches s3://%s/%s.", u.Host, objectKey(u))
+	}
+	urls := make([]*url.URL, 0, len(objects))
+	for _, obj := range objects {
+		v := *u
+		v.Path = "/" + aws.ToString(obj.Key)
+		urls = append(urls, &v)
+	}
+	return urls, nil
 }
 
-func newS3Client(ctx context.Context, bucket, regionHint string) (*s3manager.Downloader, error) {
-	sess := session.Must(session.NewSession())
+func listObjects(ctx context.Context, client *s3.Client, u *url.URL) ([]types.Object, error) {
+	prefix, match := loader.ObjectMatcher(objectKey(u))
+	var objects []types.Object
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(u.Host),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, objectError(u, err)
+		}
+		for _, obj := range out.Contents {
+			if match(aws.ToString(obj.Key)) {
+				objects = append(objects, obj)
+			}
+		}
+	}
+	slices.SortFunc(objects, func(a, b types.Object) int {
+		return strings.Compare(aws.ToString(a.Key), aws.ToString(b.Key))
+	})
+	return objects, nil
+}
 
-	r, err := s3manager.GetBucketRegion(ctx, sess, bucket, regionHint)
+// WatchWithContext polls the ETag and LastModified of the object, and notifies when either of them changes.
+// For several objects, the addition and the removal of the objects are also notified.
+// The interval can be specified with the pollInterval query, e.g. s3://bucket/key?pollInterval=30s
+func (d *Loader) WatchWithContext(ctx context.Context, u *url.URL) (<-chan struct{}, error) {
+	interval, err := loader.PollInterval(u)
 	if err != nil {
 		return nil, err
 	}
-	sess.Config.Region = aws.String(r)
+	client, err := newClient(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if loader.IsMultiObject(objectKey(u)) {
+		return loader.Poll(ctx, interval, func(ctx context.Context) (string, error) {
+			objects, err := listObjects(ctx, client, u)
+			if err != nil {
+				return "", err
+			}
+			var versions []string
+			for _, obj := range objects {
+				versions = append(versions, fmt.Sprintf("%s:%s/%s", aws.ToString(obj.Key), aws.ToString(obj.ETag), aws.ToTime(obj.LastModified).Format(time.RFC3339Nano)))
+			}
+			return strings.Join(versions, ","), nil
+		})
+	}
+	return loader.Poll(ctx, interval, func(ctx context.Context) (string, error) {
+		input := &s3.HeadObjectInput{
+			Bucket: aws.String(u.Host),
+			Key:    aws.String(objectKey(u)),
+		}
+		if v := versionID(u); v != "" {
+			input.VersionId = aws.String(v)
+		}
+		out, err := client.HeadObject(ctx, input)
+		if err != nil {
+			return "", objectError(u, err)
+		}
+		return objectVersion(out), nil
+	})
+}
 
-	return s3manager.NewDownloader(sess), nil
+// objectVersion returns a string that changes whenever the object is updated.
+func objectVersion(out *s3.HeadObjectOutput) string {
+	return fmt.Sprintf("%s/%s", aws.ToString(out.ETag), aws.ToTime(out.LastModified).Format(time.RFC3339Nano))
 }
 
-func fetchFromBucket(ctx context.Context, client *s3manager.Downloader, bucket, key string) ([]byte, error) {
-	buf := &aws.WriteAtBuffer{}
+func newClient(ctx context.Context, u *url.URL) (*s3.Client, error) {
+	cfg, err := awsconfig.Load(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	pathStyle := false
+	if ps := strings.TrimSpace(q.Get("pathStyle")); ps != "" {
+		if pathStyle, err = strconv.ParseBool(ps); err != nil {
+			return nil, fmt.Errorf("Invalid pathStyle: %w", err)
+		}
+	}
+	optFn := func(o *s3.Options) {
+		o.UsePathStyle = pathStyle
+	}
+	client := s3.NewFromConfig(cfg, optFn)
 
-	input := &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
+	// The region of the bucket is only looked up when it is unknown, since a custom endpoint may not support it.
+	if strings.TrimSpace(q.Get("regionHint")) != "" || cfg.BaseEndpoint != nil {
+		return client, nil
 	}
-	if _, err := client.Download(buf, input); err != nil {
+	region, err := manager.GetBucketRegion(ctx, client, u.Host)
+	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	if region == cfg.Region {
+		return client, nil
+	}
+	return s3.NewFromConfig(cfg, optFn, func(o *s3.Options) {
+		o.Region = region
+	}), nil
+}
+
+func fetchFromBucket(ctx context.Context, client *s3.Client, u *url.URL) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(objectKey(u)),
+	}
+	if v := versionID(u); v != "" {
+		input.VersionId = aws.String(v)
+	}
+	out, err := client.GetObject(ctx, input)
+	if err != nil {
+		return nil, objectError(u, err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// objectKey returns the key of the object, in which the leading slash of the path is trimmed.
+func objectKey(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+func versionID(u *url.URL) string {
+	return strings.TrimSpace(u.Query().Get("versionId"))
+}
+
+// objectError classifies the error returned from the SDK into ObjectError if possible.
+func objectError(u *url.URL, err error) error {
+	var kind error
+	var apiErr smithy.APIError
+	var resErr *awshttp.ResponseError
+	switch {
+	case errors.As(err, &apiErr) && slices.Contains([]string{"NoSuchKey", "NoSuchBucket", "NoSuchVersion", "NotFound"}, apiErr.ErrorCode()):
+		kind = ErrNoSuchObject
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied":
+		kind = ErrAccessDenied
+	case errors.As(err, &resErr) && resErr.HTTPStatusCode() == http.StatusNotFound:
+		kind = ErrNoSuchObject
+	case errors.As(err, &resErr) && resErr.HTTPStatusCode() == http.StatusForbidden:
+		kind = ErrAccessDenied
+	default:
+		return err
+	}
+	return &ObjectError{Bucket: u.Host, Key: objectKey(u), kind: kind, err: err}
 }
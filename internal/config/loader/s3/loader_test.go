@@ -0,0 +1,140 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 serves the objects with the path-style addressing, like MinIO.
+func fakeS3(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.URL.Path {
+		case "/ikesu", "/ikesu/":
+			var contents string
+			for _, key := range []string{"conf.d/b.yml", "conf.d/a.yaml", "conf.d/sub/c.yml", "conf.d/README.md"} {
+				if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+					contents += fmt.Sprintf("<Contents><Key>%s</Key><ETag>&quot;%s&quot;</ETag></Contents>", key, key)
+				}
+			}
+			fmt.Fprintf(w, `<ListBucketResult><Name>ikesu</Name><IsTruncated>false</IsTruncated>%s</ListBucketResult>`, contents)
+		case "/ikesu/check.yml":
+			body := "check: []\n"
+			if r.URL.Query().Get("versionId") == "v1" {
+				body = "check: [v1]\n"
+			}
+			w.Header().Set("ETag", `"abc"`)
+			_, _ = w.Write([]byte(body))
+		case "/ikesu/secret.yml":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+		}
+	}))
+}
+
+func TestLoadWithContext(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	ts := fakeS3(t)
+	defer ts.Close()
+	query := "?pathStyle=true&endpoint=" + url.QueryEscape(ts.URL)
+	load := func(rawURL string) ([]byte, error) {
+		u, _ := url.Parse(rawURL)
+		return (&Loader{}).LoadWithContext(context.Background(), u)
+	}
+
+	buf, err := load("s3://ikesu/check.yml" + query)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+
+	buf, err = load("s3://ikesu/check.yml" + query + "&versionId=v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "check: [v1]\n", string(buf))
+
+	_, err = load("s3://ikesu/missing.yml" + query)
+	assert.ErrorIs(t, err, ErrNoSuchObject)
+	var noSuchKey *types.NoSuchKey
+	assert.True(t, errors.As(err, &noSuchKey))
+	var objErr *ObjectError
+	assert.True(t, errors.As(err, &objErr))
+	assert.Equal(t, "ikesu", objErr.Bucket)
+	assert.Equal(t, "missing.yml", objErr.Key)
+
+	_, err = load("s3://ikesu/secret.yml" + query)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+
+	_, err = load("s3://ikesu/check.yml?pathStyle=maybe&endpoint=" + url.QueryEscape(ts.URL))
+	assert.ErrorContains(t, err, "Invalid pathStyle")
+}
+
+func TestListWithContext(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	ts := fakeS3(t)
+	defer ts.Close()
+	query := "?pathStyle=true&endpoint=" + url.QueryEscape(ts.URL)
+	list := func(rawURL string) ([]string, error) {
+		u, _ := url.Parse(rawURL)
+		urls, err := (&Loader{}).ListWithContext(context.Background(), u)
+		var keys []string
+		for _, u := range urls {
+			keys = append(keys, objectKey(u))
+		}
+		return keys, err
+	}
+
+	keys, err := list("s3://ikesu/conf.d/" + query)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"conf.d/a.yaml", "conf.d/b.yml"}, keys)
+
+	keys, err = list("s3://ikesu/conf.d/*/*.yml" + query)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"conf.d/sub/c.yml"}, keys)
+
+	keys, err = list("s3://ikesu/check.yml" + query)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"check.yml"}, keys)
+
+	_, err = list("s3://ikesu/other.d/" + query)
+	assert.ErrorContains(t, err, "No config object matches s3://ikesu/other.d/.")
+
+	_, err = list("s3://ikesu/conf.d/" + query + "&versionId=v1")
+	assert.ErrorContains(t, err, "versionId cannot be specified for several objects")
+
+	keys, err = list("s3://ikesu/check.yml" + query + "&versionId=v1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"check.yml"}, keys)
+}
+
+func TestObjectVersion(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	v1 := objectVersion(&s3.HeadObjectOutput{ETag: aws.String(`"abc"`), LastModified: aws.Time(modified)})
+	v2 := objectVersion(&s3.HeadObjectOutput{ETag: aws.String(`"abc"`), LastModified: aws.Time(modified.Add(time.Second))})
+	v3 := objectVersion(&s3.HeadObjectOutput{ETag: aws.String(`"def"`), LastModified: aws.Time(modified)})
+	assert.NotEqual(t, v1, v2)
+	assert.NotEqual(t, v1, v3)
+}
@@ -0,0 +1,59 @@
+package secretsmanager
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/tukaelu/ikesu/internal/config/loader"
+	"github.com/tukaelu/ikesu/internal/config/loader/awsconfig"
+)
+
+var ErrEmptySecret = fmt.Errorf("The specified secret is empty.")
+
+func init() {
+	loader.Register("secretsmanager", &Loader{})
+}
+
+// Loader loads the configuration from a secret of AWS Secrets Manager.
+// e.g. secretsmanager://ikesu/check?regionHint=ap-northeast-1
+//
+// In addition to the query parameters of awsconfig.Load, versionId or versionStage selects the version of the secret.
+type Loader struct{}
+
+func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	cfg, err := awsconfig.Load(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	client := secretsmanager.NewFromConfig(cfg)
+
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(awsconfig.Name(u)),
+	}
+	q := u.Query()
+	if v := strings.TrimSpace(q.Get("versionId")); v != "" {
+		input.VersionId = aws.String(v)
+	}
+	if v := strings.TrimSpace(q.Get("versionStage")); v != "" {
+		input.VersionStage = aws.String(v)
+	}
+	out, err := client.GetSecretValue(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// A secret is either a string or a binary.
+	buf := out.SecretBinary
+	if out.SecretString != nil {
+		buf = []byte(aws.ToString(out.SecretString))
+	}
+	if len(strings.TrimSpace(string(buf))) == 0 {
+		return nil, ErrEmptySecret
+	}
+	return buf, nil
+}
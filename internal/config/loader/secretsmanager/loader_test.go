@@ -0,0 +1,72 @@
+package secretsmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSecretsManager serves GetSecretValue of the JSON protocol of AWS Secrets Manager, like LocalStack.
+func fakeSecretsManager(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		var in struct {
+			SecretId     string
+			VersionId    string
+			VersionStage string
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch in.SecretId {
+		case "ikesu/check":
+			value := "check: []\n"
+			if in.VersionStage == "AWSPREVIOUS" {
+				value = "check: [previous]\n"
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"Name": in.SecretId, "SecretString": value})
+		case "ikesu/binary":
+			_ = json.NewEncoder(w).Encode(map[string]any{"Name": in.SecretId, "SecretBinary": []byte("check: []\n")})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+		}
+	}))
+}
+
+func TestLoadWithContext(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	ts := fakeSecretsManager(t)
+	defer ts.Close()
+	endpoint := "endpoint=" + url.QueryEscape(ts.URL)
+
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"secretsmanager://ikesu/check?" + endpoint, "check: []\n"},
+		{"secretsmanager://ikesu/check?versionStage=AWSPREVIOUS&" + endpoint, "check: [previous]\n"},
+		{"secretsmanager://ikesu/binary?" + endpoint, "check: []\n"},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse(c.url)
+		buf, err := (&Loader{}).LoadWithContext(context.Background(), u)
+		assert.NoError(t, err, c.url)
+		assert.Equal(t, c.expected, string(buf), c.url)
+	}
+
+	u, _ := url.Parse("secretsmanager://ikesu/missing?" + endpoint)
+	_, err := (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
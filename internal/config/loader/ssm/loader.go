@@ -0,0 +1,48 @@
+package ssm
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"github.com/tukaelu/ikesu/internal/config/loader"
+	"github.com/tukaelu/ikesu/internal/config/loader/awsconfig"
+)
+
+var ErrEmptyParameter = fmt.Errorf("The specified parameter is empty.")
+
+func init() {
+	loader.Register("ssm", &Loader{})
+}
+
+// Loader loads the configuration from a parameter of AWS Systems Manager Parameter Store.
+// e.g. ssm:///ikesu/check.yml?regionHint=ap-northeast-1
+//
+// A SecureString parameter is decrypted. In addition to the query parameters of awsconfig.Load,
+// a version or a label can be selected with the name, e.g. ssm:///ikesu/check.yml:3
+type Loader struct{}
+
+func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	cfg, err := awsconfig.Load(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	client := ssm.NewFromConfig(cfg)
+
+	name := awsconfig.Name(u)
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.Parameter == nil || strings.TrimSpace(aws.ToString(out.Parameter.Value)) == "" {
+		return nil, ErrEmptyParameter
+	}
+	return []byte(aws.ToString(out.Parameter.Value)), nil
+}
@@ -0,0 +1,68 @@
+package ssm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSSM serves GetParameter of the JSON protocol of AWS Systems Manager, like LocalStack.
+func fakeSSM(t *testing.T, parameters map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonSSM.GetParameter", r.Header.Get("X-Amz-Target"))
+		var in struct {
+			Name           string
+			WithDecryption bool
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		assert.True(t, in.WithDecryption)
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		value, ok := parameters[in.Name]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ParameterNotFound","message":"not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"Parameter": map[string]any{"Name": in.Name, "Type": "SecureString", "Value": value},
+		})
+	}))
+}
+
+func setup(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+}
+
+func TestLoadWithContext(t *testing.T) {
+	setup(t)
+	ts := fakeSSM(t, map[string]string{
+		"/ikesu/check.yml": "check: []\n",
+		"/ikesu/empty":     "",
+	})
+	defer ts.Close()
+
+	u, _ := url.Parse("ssm:///ikesu/check.yml?endpoint=" + url.QueryEscape(ts.URL))
+	buf, err := (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+
+	u, _ = url.Parse("ssm:///ikesu/empty?endpoint=" + url.QueryEscape(ts.URL))
+	_, err = (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.ErrorIs(t, err, ErrEmptyParameter)
+
+	u, _ = url.Parse("ssm:///ikesu/missing?endpoint=" + url.QueryEscape(ts.URL))
+	_, err = (&Loader{}).LoadWithContext(context.Background(), u)
+	assert.ErrorContains(t, err, "ParameterNotFound")
+}
@@ -0,0 +1,38 @@
+package stdin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/tukaelu/ikesu/internal/config/loader"
+)
+
+var ErrEmptyConfig = fmt.Errorf("The config read from the standard input is empty.")
+
+func init() {
+	loader.Register("stdin", &Loader{In: os.Stdin})
+}
+
+// Loader loads the configuration from the standard input, which is specified as "-".
+// Since the input can be read only once, the content read first is returned afterwards, e.g. when the configuration is reloaded.
+type Loader struct {
+	In io.Reader
+
+	once sync.Once
+	buf  []byte
+	err  error
+}
+
+func (d *Loader) LoadWithContext(ctx context.Context, u *url.URL) ([]byte, error) {
+	d.once.Do(func() {
+		d.buf, d.err = io.ReadAll(d.In)
+		if d.err == nil && len(d.buf) == 0 {
+			d.err = ErrEmptyConfig
+		}
+	})
+	return d.buf, d.err
+}
@@ -0,0 +1,27 @@
+package stdin
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadWithContext(t *testing.T) {
+	l := &Loader{In: strings.NewReader("check: []\n")}
+	u := &url.URL{Path: "-"}
+
+	buf, err := l.LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+
+	// The content read first is returned again.
+	buf, err = l.LoadWithContext(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Equal(t, "check: []\n", string(buf))
+
+	_, err = (&Loader{In: strings.NewReader("")}).LoadWithContext(context.Background(), u)
+	assert.ErrorIs(t, err, ErrEmptyConfig)
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/tukaelu/ikesu/internal/constants"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the intervals accepted by time.ParseDuration, e.g. 30m or 1h30m.
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// JSONSchema is a subset of JSON Schema to describe the configuration.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	PropertyNames        *JSONSchema            `json:"propertyNames,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+}
+
+// requiredFields is the fields that must be specified for each type, which are checked by Validate.
+var requiredFields = map[reflect.Type][]string{
+	reflect.TypeOf(MetricCheckRule{}):        {"name", "service"},
+	reflect.TypeOf(ServiceMetricCheckRule{}): {"name", "service", "inspection_metrics", "report_host_id"},
+}
+
+// enumValues returns the values that the types accept.
+func enumValues(t reflect.Type) []string {
+	switch t {
+	case reflect.TypeOf(Provider("")):
+		return constants.GetProviders()
+	case reflect.TypeOf(Strategy("")):
+		return []string{string(StrategyWindow), string(StrategyLatest)}
+	case reflect.TypeOf(Match("")):
+		return []string{string(MatchAny), string(MatchAll)}
+	case reflect.TypeOf(OnAPIError("")):
+		return []string{string(OnAPIErrorUnknown), string(OnAPIErrorSkip)}
+	}
+	return nil
+}
+
+// NewJSONSchema returns the JSON Schema of CheckConfig generated from the types, so that the editors can complete and validate the configuration.
+// It covers the fields and their types, but not the constraints between the fields, which are checked by Validate.
+func NewJSONSchema() *JSONSchema {
+	s := schemaOf(reflect.TypeOf(CheckConfig{}))
+	s.Schema = jsonSchemaDraft
+	s.Title = "ikesu check configuration"
+	return s
+}
+
+// MarshalIndent returns the schema in the indented JSON.
+func (s *JSONSchema) MarshalIndent() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func schemaOf(t reflect.Type) *JSONSchema {
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &JSONSchema{
+			Type:                 "object",
+			Properties:           make(map[string]*JSONSchema),
+			AdditionalProperties: false,
+			Required:             requiredFields[t],
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			s.Properties[name] = schemaOf(f.Type)
+		}
+		return s
+	case reflect.Slice:
+		return &JSONSchema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		s := &JSONSchema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+		if enum := enumValues(t.Key()); enum != nil {
+			s.PropertyNames = &JSONSchema{Enum: enum}
+		}
+		return s
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		zero := 0
+		return orEnvRef(&JSONSchema{Type: "integer", Minimum: &zero})
+	case reflect.Bool:
+		return orEnvRef(&JSONSchema{Type: "boolean"})
+	}
+
+	s := &JSONSchema{Type: "string", Enum: enumValues(t)}
+	if t == reflect.TypeOf(InterruptedInterval("")) {
+		s.Pattern = durationPattern
+	}
+	if s.Enum == nil && s.Pattern == "" {
+		return s
+	}
+	return orEnvRef(s)
+}
+
+// orEnvRef returns the schema which also accepts a reference to an environment variable such as ${INTERVAL:-24h},
+// since the constraints apply to the expanded value, see expandNode.
+func orEnvRef(s *JSONSchema) *JSONSchema {
+	return &JSONSchema{AnyOf: []*JSONSchema{s, {Type: "string", Pattern: envRefPattern}}}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJSONSchema(t *testing.T) {
+	s := NewJSONSchema()
+	assert.Equal(t, jsonSchemaDraft, s.Schema)
+	assert.Equal(t, false, s.AdditionalProperties)
+
+	rule := s.Properties["check"].Items
+	assert.Equal(t, []string{"name", "service"}, rule.Required)
+	assert.Contains(t, rule.Properties["providers"].Items.AnyOf[0].Enum, "ec2")
+	assert.Equal(t, []string{"window", "latest"}, rule.Properties["strategy"].AnyOf[0].Enum)
+	assert.Equal(t, "array", rule.Properties["inspection_metrics"].AdditionalProperties.(*JSONSchema).Type)
+	assert.Equal(t, "integer", rule.Properties["min_present"].AnyOf[0].Type)
+	assert.Equal(t, "string", rule.Properties["service"].Type)
+
+	serviceRule := s.Properties["service_check"].Items
+	assert.Equal(t, []string{"name", "service", "inspection_metrics", "report_host_id"}, serviceRule.Required)
+	assert.Equal(t, "string", serviceRule.Properties["inspection_metrics"].Items.Type)
+
+	assert.Equal(t, "string", s.Properties["defaults"].Properties["interrupted_interval"].AnyOf[0].Type)
+	assert.NotContains(t, s.Properties["defaults"].Properties, "name")
+	providerDefaults := s.Properties["provider_defaults"]
+	assert.Contains(t, providerDefaults.PropertyNames.Enum, "ec2")
+	assert.Equal(t, "array", providerDefaults.AdditionalProperties.(*JSONSchema).Properties["inspection_metrics"].Type)
+
+	re := regexp.MustCompile(rule.Properties["interrupted_interval"].AnyOf[0].Pattern)
+	for _, v := range []string{"24h", "1h30m", "0.5h"} {
+		assert.True(t, re.MatchString(v), v)
+	}
+	assert.False(t, re.MatchString("1 day"))
+
+	// The references to the environment variables are accepted in place of the values, since they are expanded before the validation.
+	envRef := regexp.MustCompile(rule.Properties["interrupted_interval"].AnyOf[1].Pattern)
+	for _, v := range []string{"${INTERVAL}", "${INTERVAL:-24h}", "${MIN_PRESENT}"} {
+		assert.True(t, envRef.MatchString(v), v)
+	}
+	for _, v := range []string{"$${INTERVAL}", "$INTERVAL", "1 day"} {
+		assert.False(t, envRef.MatchString(v), v)
+	}
+	assert.Equal(t, envRef.String(), rule.Properties["min_present"].AnyOf[1].Pattern)
+
+	buf, err := s.MarshalIndent()
+	assert.NoError(t, err)
+	assert.True(t, json.Valid(buf))
+	assert.Contains(t, string(buf), `"additionalProperties": false`)
+}
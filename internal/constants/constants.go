@@ -12,7 +12,7 @@ const (
 
 // Determine the name of the metric that must be retained by the integration.
 // If a combination exists for a provider, the metric that exists in that case is also enumerated. (e.g. agent-ec2)
-// Metric names containing wildcards are not supported. And additionally, this definition does not ensure a guaranteed certainty.
+// Metric names may contain wildcards ('*'), which are expanded with the metric names posted by each host. And additionally, this definition does not ensure a guaranteed certainty.
 // FIXME: The definition of this Map is incomplete.
 var providersInspectionMetricMap = map[string]map[string]string{
 	// AWS Integrations
@@ -38,10 +38,10 @@ var providersInspectionMetricMap = map[string]map[string]string{
 		"states":        "custom.states.executions.succeeded", // Step Functions
 		"efs":           "custom.efs.client_connections.count",
 		"firehose":      "custom.firehose.throttled_records.records",
-		"batch":         "", // It is not supported because there are only metric names that include wildcards.
-		"waf":           "", // It is not supported because there are only metric names that include wildcards.
-		"aws/billing":   "", // It is not supported because i couldn't find any metrics that are guaranteed to be reliably obtained.
-		"aws/route53":   "", // It is not supported because i couldn't find any metrics that are guaranteed to be reliably obtained.
+		"batch":         "custom.batch.*", // The metric names include the job queue name, so any of them is inspected.
+		"waf":           "custom.waf.*",   // The metric names include the rule name, so any of them is inspected.
+		"aws/billing":   "",               // It is not supported because i couldn't find any metrics that are guaranteed to be reliably obtained.
+		"aws/route53":   "",               // It is not supported because i couldn't find any metrics that are guaranteed to be reliably obtained.
 		"aws/connect":   "custom.connect.voice_calls.concurrent_calls",
 		"aws/docdb":     "", // It is not supported because i couldn't find any metrics that are guaranteed to be reliably obtained.
 		"aws/codebuild": "custom.codebuild.builds.count",
@@ -55,11 +55,11 @@ var providersInspectionMetricMap = map[string]map[string]string{
 		"azurevm":                  "custom.azure.virtual_machine.cpu.percent",             // There might not be a guarantee of reliable acquisition.
 		"appservice":               "custom.azure.app_service.requests.requests",           // There might not be a guarantee of reliable acquisition.
 		"functions":                "custom.azure.functions.requests.requests",             // There might not be a guarantee of reliable acquisition.
-		"azure/loadbalancer":       "",                                                     // It is not supported because there are only metric names that include wildcards.
+		"azure/loadbalancer":       "custom.azure.load_balancer.*",                         // The metric names include the frontend name, so any of them is inspected.
 		"azure/dbformysql":         "custom.azure.db_for_mysql.connections.active",         // There might not be a guarantee of reliable acquisition.
 		"azure/dbforpostgresql":    "custom.azure.db_for_postgresql.connections.active",    // There might not be a guarantee of reliable acquisition.
 		"azure/applicationgateway": "custom.azure.application_gateway.response_status.2xx", // There might not be a guarantee of reliable acquisition.
-		"azure/blobstorage":        "",                                                     // It is not supported because there are only metric names that include wildcards.
+		"azure/blobstorage":        "custom.azure.blob_storage.*",                          // The metric names include the API name, so any of them is inspected.
 		"azure/files":              "custom.azure.files.file_share_count.count",            // There might not be a guarantee of reliable acquisition.
 	},
 
@@ -20,3 +20,9 @@ func TestGetProviders(t *testing.T) {
 	providers := GetProviders()
 	assert.Equal(t, 46, len(providers), "The number of providers supported should be returned.")
 }
+
+func TestGetProviderInspectionMetricNamesWithWildcard(t *testing.T) {
+	batch, ok := GetProviderInspectionMetricName("batch")
+	assert.Equal(t, true, ok, "must be true because it is supported with a wildcard.")
+	assert.Equal(t, "custom.batch.*", batch, "matching metric name corresponding to the provider.")
+}
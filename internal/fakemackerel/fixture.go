@@ -0,0 +1,123 @@
+package fakemackerel
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is the data to be registered in the server, written in YAML.
+type Fixture struct {
+	Services       []FixtureService             `yaml:"services"`
+	Hosts          []FixtureHost                `yaml:"hosts"`
+	ServiceMetrics map[string]map[string]Series `yaml:"service_metrics"`
+}
+
+type FixtureService struct {
+	Name  string   `yaml:"name"`
+	Roles []string `yaml:"roles"`
+}
+
+type FixtureHost struct {
+	ID        string              `yaml:"id"`
+	Name      string              `yaml:"name"`
+	Roles     map[string][]string `yaml:"roles"`
+	AgentName string              `yaml:"agent_name"`
+	Provider  string              `yaml:"provider"`
+	Metrics   map[string]Series   `yaml:"metrics"`
+}
+
+// Series generates metric values posted at regular intervals over the duration until LastPosted before now.
+// e.g. {last_posted: 30m, interval: 1m, duration: 24h}
+type Series struct {
+	LastPosted string `yaml:"last_posted"`
+	Interval   string `yaml:"interval"`
+	Duration   string `yaml:"duration"`
+}
+
+// LoadFixture returns the fixture loaded from the YAML file.
+func LoadFixture(path string) (*Fixture, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fixture{}
+	if err := yaml.Unmarshal(buf, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Load registers the fixture in the server. The metric values are generated relative to now.
+func (s *Server) Load(f *Fixture, now time.Time) error {
+	for _, svc := range f.Services {
+		s.AddService(svc.Name, svc.Roles...)
+	}
+	for _, h := range f.Hosts {
+		host := &mackerel.Host{
+			ID:     h.ID,
+			Name:   h.Name,
+			Status: mackerel.HostStatusWorking,
+			Roles:  h.Roles,
+			Meta:   mackerel.HostMeta{AgentName: h.AgentName},
+		}
+		if h.Provider != "" {
+			host.Meta.Cloud = &mackerel.Cloud{Provider: h.Provider}
+		}
+		s.AddHost(host)
+		for name, series := range h.Metrics {
+			values, err := series.Generate(now)
+			if err != nil {
+				return fmt.Errorf("metric '%s' of host '%s': %w", name, h.ID, err)
+			}
+			s.PostHostMetricValues(h.ID, name, values...)
+		}
+	}
+	for service, metrics := range f.ServiceMetrics {
+		for name, series := range metrics {
+			values, err := series.Generate(now)
+			if err != nil {
+				return fmt.Errorf("metric '%s' of service '%s': %w", name, service, err)
+			}
+			s.PostServiceMetricValues(service, name, values...)
+		}
+	}
+	return nil
+}
+
+// Generate returns the metric values of the series relative to now.
+// The interval defaults to 1m and the duration defaults to 24h.
+func (s Series) Generate(now time.Time) ([]mackerel.MetricValue, error) {
+	lastPosted, err := parseDuration(s.LastPosted, 0)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := parseDuration(s.Interval, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive: %s", s.Interval)
+	}
+	duration, err := parseDuration(s.Duration, 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	end := now.Add(-lastPosted)
+	var values []mackerel.MetricValue
+	for t := end.Add(-duration); !t.After(end); t = t.Add(interval) {
+		values = append(values, mackerel.MetricValue{Time: t.Unix(), Value: 1})
+	}
+	return values, nil
+}
+
+func parseDuration(s string, defaultValue time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,306 @@
+package fakemackerel
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mackerelio/mackerel-client-go"
+)
+
+// Report is a check monitoring report received by the server.
+type Report struct {
+	Source struct {
+		Type   string `json:"type"`
+		HostID string `json:"hostId"`
+	} `json:"source"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	OccurredAt int64  `json:"occurredAt"`
+}
+
+// Server is a fake of the Mackerel API that serves the hosts, services and metrics registered in advance,
+// and records the posted check monitoring reports.
+// It only implements the endpoints used by ikesu.
+type Server struct {
+	mu             sync.Mutex
+	services       []*mackerel.Service
+	hosts          []*mackerel.Host
+	hostMetrics    map[string]map[string][]mackerel.MetricValue
+	serviceMetrics map[string]map[string][]mackerel.MetricValue
+	reports        []Report
+	failures       map[string]int
+	requests       int
+}
+
+// NewServer returns an empty fake server.
+func NewServer() *Server {
+	return &Server{
+		hostMetrics:    make(map[string]map[string][]mackerel.MetricValue),
+		serviceMetrics: make(map[string]map[string][]mackerel.MetricValue),
+		failures:       make(map[string]int),
+	}
+}
+
+// AddService registers a service with its roles.
+func (s *Server) AddService(name string, roles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services = append(s.services, &mackerel.Service{Name: name, Roles: roles})
+}
+
+// AddHost registers a host. The host belongs to the services and roles in host.Roles.
+func (s *Server) AddHost(host *mackerel.Host) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts = append(s.hosts, host)
+}
+
+// PostHostMetricValues adds the metric values of the host.
+func (s *Server) PostHostMetricValues(hostID, name string, values ...mackerel.MetricValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	postMetricValues(s.hostMetrics, hostID, name, values)
+}
+
+// PostServiceMetricValues adds the metric values of the service.
+func (s *Server) PostServiceMetricValues(service, name string, values ...mackerel.MetricValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	postMetricValues(s.serviceMetrics, service, name, values)
+}
+
+// FailWith makes the requests whose path starts with the prefix respond with the status code.
+// If the status code is 0, the failure is cleared.
+func (s *Server) FailWith(pathPrefix string, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if statusCode == 0 {
+		delete(s.failures, pathPrefix)
+		return
+	}
+	s.failures[pathPrefix] = statusCode
+}
+
+// Reports returns the check monitoring reports posted so far.
+func (s *Server) Reports() []Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.reports)
+}
+
+// Requests returns the number of API requests received so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func postMetricValues(m map[string]map[string][]mackerel.MetricValue, key, name string, values []mackerel.MetricValue) {
+	if _, ok := m[key]; !ok {
+		m[key] = make(map[string][]mackerel.MetricValue)
+	}
+	for _, v := range values {
+		v.Name = name
+		m[key][name] = append(m[key][name], v)
+	}
+	slices.SortFunc(m[key][name], func(a, b mackerel.MetricValue) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	for prefix, code := range s.failures {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			writeError(w, code, http.StatusText(code))
+			return
+		}
+	}
+
+	// It is not a Mackerel API, but shows the received reports when running locally.
+	if r.Method == http.MethodGet && r.URL.Path == "/_fake/reports" {
+		writeJSON(w, map[string]any{"reports": s.reports})
+		return
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(path) < 3 || path[0] != "api" || path[1] != "v0" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	path = path[2:]
+	q := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodGet && match(path, "services"):
+		writeJSON(w, map[string]any{"services": s.services})
+	case r.Method == http.MethodGet && match(path, "services", "*", "roles"):
+		s.serveRoles(w, path[1])
+	case r.Method == http.MethodGet && match(path, "services", "*", "metric-names"):
+		writeJSON(w, map[string]any{"names": metricNames(s.serviceMetrics[path[1]])})
+	case r.Method == http.MethodGet && match(path, "services", "*", "metrics"):
+		s.serveMetricValues(w, s.serviceMetrics[path[1]], q)
+	case r.Method == http.MethodGet && match(path, "hosts"):
+		s.serveHosts(w, q)
+	case r.Method == http.MethodGet && match(path, "hosts", "*"):
+		if host := s.findHost(path[1]); host != nil {
+			writeJSON(w, map[string]any{"host": host})
+		} else {
+			writeError(w, http.StatusNotFound, "host not found")
+		}
+	case r.Method == http.MethodGet && match(path, "hosts", "*", "metric-names"):
+		writeJSON(w, map[string]any{"names": metricNames(s.hostMetrics[path[1]])})
+	case r.Method == http.MethodGet && match(path, "hosts", "*", "metrics"):
+		s.serveMetricValues(w, s.hostMetrics[path[1]], q)
+	case r.Method == http.MethodGet && match(path, "tsdb", "latest"):
+		s.serveLatestMetricValues(w, q)
+	case r.Method == http.MethodPost && match(path, "monitoring", "checks", "report"):
+		s.receiveReports(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveRoles(w http.ResponseWriter, service string) {
+	for _, svc := range s.services {
+		if svc.Name != service {
+			continue
+		}
+		roles := make([]*mackerel.Role, 0, len(svc.Roles))
+		for _, role := range svc.Roles {
+			roles = append(roles, &mackerel.Role{Name: role})
+		}
+		writeJSON(w, map[string]any{"roles": roles})
+		return
+	}
+	writeError(w, http.StatusNotFound, "service not found")
+}
+
+func (s *Server) serveHosts(w http.ResponseWriter, q map[string][]string) {
+	service := first(q["service"])
+	roles := q["role"]
+	hosts := make([]*mackerel.Host, 0)
+	for _, host := range s.hosts {
+		if host.IsRetired {
+			continue
+		}
+		if service != "" {
+			hostRoles, ok := host.Roles[service]
+			if !ok {
+				continue
+			}
+			if len(roles) > 0 && !slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(hostRoles, role) }) {
+				continue
+			}
+		}
+		hosts = append(hosts, host)
+	}
+	writeJSON(w, map[string]any{"hosts": hosts})
+}
+
+func (s *Server) findHost(id string) *mackerel.Host {
+	for _, host := range s.hosts {
+		if host.ID == id {
+			return host
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveMetricValues(w http.ResponseWriter, metrics map[string][]mackerel.MetricValue, q map[string][]string) {
+	values, ok := metrics[first(q["name"])]
+	if !ok {
+		writeError(w, http.StatusNotFound, "metric not found")
+		return
+	}
+	from, _ := strconv.ParseInt(first(q["from"]), 10, 64)
+	to, _ := strconv.ParseInt(first(q["to"]), 10, 64)
+	matched := make([]mackerel.MetricValue, 0)
+	for _, v := range values {
+		if from <= v.Time && v.Time <= to {
+			matched = append(matched, v)
+		}
+	}
+	writeJSON(w, map[string]any{"metrics": matched})
+}
+
+func (s *Server) serveLatestMetricValues(w http.ResponseWriter, q map[string][]string) {
+	latest := make(map[string]map[string]*mackerel.MetricValue)
+	for _, hostID := range q["hostId"] {
+		latest[hostID] = make(map[string]*mackerel.MetricValue)
+		for _, name := range q["name"] {
+			if values := s.hostMetrics[hostID][name]; len(values) > 0 {
+				v := values[len(values)-1]
+				latest[hostID][name] = &v
+			} else {
+				latest[hostID][name] = nil
+			}
+		}
+	}
+	writeJSON(w, map[string]any{"tsdbLatest": latest})
+}
+
+func (s *Server) receiveReports(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Reports []Report `json:"reports"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(body.Reports) > 100 {
+		writeError(w, http.StatusBadRequest, "too many reports")
+		return
+	}
+	s.reports = append(s.reports, body.Reports...)
+	writeJSON(w, map[string]any{"success": true})
+}
+
+func match(path []string, pattern ...string) bool {
+	if len(path) != len(pattern) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func metricNames(metrics map[string][]mackerel.MetricValue) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": message}})
+}
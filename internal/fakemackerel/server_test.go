@@ -0,0 +1,76 @@
+package fakemackerel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/mackerel-client-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := NewServer()
+	fixture, err := LoadFixture("testdata/fixture.yml")
+	assert.NoError(t, err)
+	assert.NoError(t, server.Load(fixture, now))
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client, _ := mackerel.NewClientWithOptions("dummy", ts.URL, false)
+
+	t.Run("finds hosts by service and roles", func(t *testing.T) {
+		hosts, err := client.FindHosts(&mackerel.FindHostsParam{Service: "blog", Roles: []string{"db"}})
+		assert.NoError(t, err)
+		assert.Len(t, hosts, 1)
+		assert.Equal(t, "db01", hosts[0].ID)
+		assert.Equal(t, "rds", hosts[0].Meta.Cloud.Provider)
+
+		hosts, err = client.FindHosts(&mackerel.FindHostsParam{Service: "blog"})
+		assert.NoError(t, err)
+		assert.Len(t, hosts, 2)
+	})
+
+	t.Run("fetches metric values", func(t *testing.T) {
+		values, err := client.FetchHostMetricValues("web01", "custom.foo.bar", now.Add(-time.Hour).Unix(), now.Unix())
+		assert.NoError(t, err)
+		// Posted every 10m until 30m ago.
+		assert.Len(t, values, 4)
+
+		_, err = client.FetchHostMetricValues("web01", "custom.unknown", now.Add(-time.Hour).Unix(), now.Unix())
+		assert.ErrorContains(t, err, "metric not found")
+
+		latest, err := client.FetchLatestMetricValues([]string{"web01", "db01"}, []string{"custom.foo.bar"})
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(-30*time.Minute).Unix(), latest["web01"]["custom.foo.bar"].Time)
+		assert.Nil(t, latest["db01"]["custom.foo.bar"])
+
+		names, err := client.ListServiceMetricNames("blog")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kpi.orders"}, names)
+	})
+
+	t.Run("records the posted reports", func(t *testing.T) {
+		err := client.PostCheckReports(&mackerel.CheckReports{Reports: []*mackerel.CheckReport{
+			{Source: mackerel.NewCheckSourceHost("web01"), Name: "check", Status: mackerel.CheckStatusCritical, OccurredAt: now.Unix()},
+		}})
+		assert.NoError(t, err)
+		reports := server.Reports()
+		assert.Len(t, reports, 1)
+		assert.Equal(t, "web01", reports[0].Source.HostID)
+		assert.Equal(t, "CRITICAL", reports[0].Status)
+	})
+
+	t.Run("fails with the status code", func(t *testing.T) {
+		server.FailWith("/api/v0/services", http.StatusTooManyRequests)
+		_, err := client.FindServices()
+		assert.Equal(t, http.StatusTooManyRequests, err.(*mackerel.APIError).StatusCode)
+
+		server.FailWith("/api/v0/services", 0)
+		roles, err := client.FindRoles("blog")
+		assert.NoError(t, err)
+		assert.Len(t, roles, 2)
+	})
+}
@@ -24,7 +24,10 @@ func NewLogger(file, level string, dryrun bool) (*Logger, error) {
 		Level: &logLevel,
 	}
 
-	if file == "" {
+	if file == "" && dryrun {
+		// In dry-run mode, stdout is reserved for the check results so that they can be piped into other tools.
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &logOpt))
+	} else if file == "" {
 		logger = slog.New(slog.NewJSONHandler(os.Stdout, &logOpt))
 	} else {
 		fw, err := newFileWriter(file)
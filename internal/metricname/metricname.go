@@ -0,0 +1,54 @@
+package metricname
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// IsPattern returns whether the metric name is a pattern rather than a literal name.
+// A name containing '*' is a wildcard, and a name enclosed in '/' is a regular expression. (e.g. custom.nginx.*, /^custom\.nginx\.(requests|connections)\./)
+func IsPattern(name string) bool {
+	return isRegexp(name) || strings.Contains(name, "*")
+}
+
+// Compile returns a regular expression that matches the metric names represented by the pattern.
+// The wildcard '*' matches any sequence of characters including dots, and it must match the whole name.
+func Compile(pattern string) (*regexp.Regexp, error) {
+	if isRegexp(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %w", pattern, err)
+		}
+		return re, nil
+	}
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// Expand returns the names that match the pattern in the order of the names.
+// If it is a literal name, it is returned as is regardless of whether it exists in the names.
+func Expand(pattern string, names []string) ([]string, error) {
+	if !IsPattern(pattern) {
+		return []string{pattern}, nil
+	}
+	re, err := Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]string, 0)
+	for _, name := range names {
+		if re.MatchString(name) && !slices.Contains(matched, name) {
+			matched = append(matched, name)
+		}
+	}
+	return matched, nil
+}
+
+func isRegexp(name string) bool {
+	return len(name) >= 2 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/")
+}
@@ -0,0 +1,61 @@
+package metricname
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPattern(t *testing.T) {
+	assert.False(t, IsPattern("custom.nginx.requests"))
+	assert.True(t, IsPattern("custom.nginx.*"))
+	assert.True(t, IsPattern("/^custom\\.nginx\\./"))
+	assert.False(t, IsPattern("/"))
+}
+
+func TestExpand(t *testing.T) {
+	names := []string{
+		"custom.nginx.requests.requests",
+		"custom.nginx.connections.active",
+		"custom.nginx.connections.waiting",
+		"custom.mysql.connections.connections",
+		"loadavg5",
+	}
+	cases := []struct {
+		pattern  string
+		expected []string
+	}{
+		{
+			pattern:  "custom.nginx.*",
+			expected: []string{"custom.nginx.requests.requests", "custom.nginx.connections.active", "custom.nginx.connections.waiting"},
+		},
+		{
+			pattern:  "custom.*.connections.*",
+			expected: []string{"custom.nginx.connections.active", "custom.nginx.connections.waiting", "custom.mysql.connections.connections"},
+		},
+		{
+			pattern:  "/^custom\\.nginx\\.(requests|connections\\.active)/",
+			expected: []string{"custom.nginx.requests.requests", "custom.nginx.connections.active"},
+		},
+		{ // The wildcard must match the whole name.
+			pattern:  "nginx.*",
+			expected: []string{},
+		},
+		{ // A literal name is returned as is.
+			pattern:  "custom.foo.bar",
+			expected: []string{"custom.foo.bar"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.pattern, func(t *testing.T) {
+			expanded, err := Expand(c.pattern, names)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, expanded)
+		})
+	}
+}
+
+func TestCompileInvalidRegexp(t *testing.T) {
+	_, err := Compile("/custom.(nginx/")
+	assert.ErrorContains(t, err, "invalid regular expression /custom.(nginx/")
+}